@@ -0,0 +1,38 @@
+package broker
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"DeadRabbit/state"
+)
+
+// DryRunRecorder collects mutating operations, which are skipped in a dry run, so they could be reported on exit
+type DryRunRecorder struct {
+	// Dlq is a queue or a topic, operations are recorded for
+	Dlq string
+
+	mu         sync.Mutex
+	operations []state.DryRunOperation
+}
+
+// RecordDryRun logs and records an operation, which would have been sent to the broker
+func (r *DryRunRecorder) RecordDryRun(operation state.DryRunOperation) {
+	operation.At = time.Now()
+	operation.Dlq = r.Dlq
+	destination := state.Destination{Exchange: operation.Exchange, RoutingKey: operation.RoutingKey}
+	log.Printf("DRY RUN: would %s message %q of %s (destination %q, delivery tag %d)",
+		operation.Operation, operation.MessageId, r.Dlq, destination, operation.DeliveryTag)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.operations = append(r.operations, operation)
+}
+
+// DryRunOperations returns operations, which were skipped because of a dry run, in order they were requested
+func (r *DryRunRecorder) DryRunOperations() []state.DryRunOperation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]state.DryRunOperation{}, r.operations...)
+}
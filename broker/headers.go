@@ -0,0 +1,14 @@
+package broker
+
+// MovedFromHeader is set on messages, moved out of the dead-letter queue or topic to another destination
+const MovedFromHeader = "x-deadrabbit-moved-from"
+
+// MarkMovedFrom returns a copy of headers, marked with a dead-letter queue or topic, a message is moved out of
+func MarkMovedFrom(headers map[string]any, from string) map[string]any {
+	marked := make(map[string]any, len(headers)+1)
+	for key, value := range headers {
+		marked[key] = value
+	}
+	marked[MovedFromHeader] = from
+	return marked
+}
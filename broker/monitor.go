@@ -0,0 +1,76 @@
+package broker
+
+import (
+	"log"
+	"time"
+
+	"DeadRabbit/state"
+)
+
+const defaultMonitorInterval = 5 * time.Second
+
+// Queue is a queue or a topic, inspected by a monitor
+type Queue struct {
+	Name string
+	// Inspect returns number of messages and consumers of the queue
+	Inspect func() (messages, consumers int, err error)
+}
+
+// MonitorQueues inspects the dead-letter queue and the target one every interval seconds in background, until done
+// is closed. Negative interval disables monitoring, zero one is 5 seconds. Target queue without a name isn't inspected.
+func MonitorQueues(interval int, done <-chan struct{}, dlq, target Queue, listener state.StatsListener) {
+	if interval < 0 {
+		return
+	}
+	period := defaultMonitorInterval
+	if interval > 0 {
+		period = time.Duration(interval) * time.Second
+	}
+
+	go func() {
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+
+		var dlqStats, targetStats state.QueueStatsStruct
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+
+			dlqStats = inspectStats(dlq, dlqStats)
+			if target.Name != "" {
+				targetStats = inspectStats(target, targetStats)
+			}
+
+			select {
+			case <-done:
+				return
+			default:
+				listener(dlqStats, targetStats)
+			}
+		}
+	}()
+}
+
+// inspectStats returns fresh stats of the queue; rate is calculated against previous stats
+func inspectStats(q Queue, previous state.QueueStatsStruct) state.QueueStatsStruct {
+	messages, consumers, err := q.Inspect()
+	if err != nil {
+		log.Printf("Can't inspect %s, err: %s", q.Name, err.Error())
+		previous.Error = err.Error()
+		return previous
+	}
+
+	stats := state.QueueStatsStruct{
+		Name:      q.Name,
+		Messages:  messages,
+		Consumers: consumers,
+		At:        time.Now(),
+	}
+	if !previous.At.IsZero() && previous.Error == "" {
+		stats.Rate = float64(messages-previous.Messages) / stats.At.Sub(previous.At).Seconds()
+	}
+	return stats
+}
@@ -0,0 +1,161 @@
+package broker
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"DeadRabbit/state"
+)
+
+const (
+	minReconnectDelay        = time.Second
+	maxReconnectDelay        = 30 * time.Second
+	defaultReconnectAttempts = 10
+)
+
+// Connect establishes a connection and returns a channel, which receives an error, once connection is lost
+type Connect func() (lost <-chan error, err error)
+
+type SupervisorConfiguration struct {
+	// Name of the broker in logs, e.g. "RabbitMQ"
+	Name string
+	// Attempts is how many times connecting is tried in a row, before giving up; 10 by default
+	Attempts int
+	// ErrNotConnected is returned by EnsureConnected, while connection isn't established
+	ErrNotConnected error
+}
+
+// Supervisor keeps a connection to a broker up: it connects, waits until connection is lost and reconnects
+// with exponential backoff. Once all attempts have failed, it waits until connection is asked for again.
+type Supervisor struct {
+	config   SupervisorConfiguration
+	connect  Connect
+	listener state.StatusListener
+
+	mu     sync.Mutex
+	status state.ConnectionStatus
+
+	retry chan struct{}
+	done  chan struct{}
+}
+
+func NewSupervisor(c SupervisorConfiguration, connect Connect, listener state.StatusListener) *Supervisor {
+	if c.Attempts <= 0 {
+		c.Attempts = defaultReconnectAttempts
+	}
+	return &Supervisor{
+		config:   c,
+		connect:  connect,
+		listener: listener,
+		status:   state.Connecting,
+		retry:    make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+// Run connects and reconnects, until supervisor is closed
+func (s *Supervisor) Run() {
+	delay := minReconnectDelay
+	attempt := 0
+
+	s.setStatus(state.Connecting, nil)
+	for {
+		lost, err := s.connect()
+		if err != nil {
+			attempt++
+			log.Printf("Can't connect to %s (attempt %d of %d), err: %v", s.config.Name, attempt, s.config.Attempts, err)
+
+			if attempt >= s.config.Attempts {
+				s.setStatus(state.Failed, err)
+				// Waiting until somebody will ask for a connection again
+				select {
+				case <-s.retry:
+				case <-s.done:
+					return
+				}
+				attempt = 0
+				delay = minReconnectDelay
+				s.setStatus(state.Connecting, nil)
+				continue
+			}
+
+			s.setStatus(state.Reconnecting, err)
+			select {
+			case <-time.After(delay):
+			case <-s.done:
+				return
+			}
+			delay *= 2
+			if delay > maxReconnectDelay {
+				delay = maxReconnectDelay
+			}
+			continue
+		}
+
+		attempt = 0
+		delay = minReconnectDelay
+		s.setStatus(state.Connected, nil)
+
+		select {
+		case err = <-lost:
+			log.Printf("%s connection lost, err: %v", s.config.Name, err)
+			s.setStatus(state.Reconnecting, err)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Close stops reconnecting; status isn't reported anymore, so it doesn't interfere with a new connection
+func (s *Supervisor) Close() {
+	close(s.done)
+}
+
+// Done is closed, once supervisor is closed
+func (s *Supervisor) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Supervisor) Status() state.ConnectionStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// EnsureConnected returns an error, unless connection is established.
+// If reconnecting has failed, it triggers another round of reconnection attempts.
+func (s *Supervisor) EnsureConnected() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch s.status {
+	case state.Connected:
+		return nil
+	case state.Failed:
+		select {
+		case s.retry <- struct{}{}:
+		default:
+		}
+	}
+	return fmt.Errorf("%w (%s)", s.config.ErrNotConnected, s.status)
+}
+
+// setStatus reports a changed status or an error; the same status without an error, e.g. of a health check, isn't
+func (s *Supervisor) setStatus(status state.ConnectionStatus, err error) {
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+
+	s.mu.Lock()
+	changed := s.status != status
+	s.status = status
+	s.mu.Unlock()
+
+	if (changed || err != nil) && s.listener != nil {
+		s.listener(status, err)
+	}
+}
@@ -0,0 +1,73 @@
+package broker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"DeadRabbit/state"
+)
+
+var errTestNotConnected = errors.New("not connected")
+
+// statuses collects reported statuses, so a test could wait for them
+func statuses() (state.StatusListener, <-chan state.ConnectionStatus) {
+	reported := make(chan state.ConnectionStatus, 10)
+	return func(status state.ConnectionStatus, err error) {
+		reported <- status
+	}, reported
+}
+
+func expectStatus(t *testing.T, reported <-chan state.ConnectionStatus, expected state.ConnectionStatus) {
+	t.Helper()
+	select {
+	case status := <-reported:
+		if status != expected {
+			t.Fatalf("expected status %s, got %s", expected, status)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("status %s isn't reported", expected)
+	}
+}
+
+func TestSupervisorReconnectsLostConnection(t *testing.T) {
+	connections := make(chan chan error, 2)
+	listener, reported := statuses()
+	s := NewSupervisor(SupervisorConfiguration{Name: "test", ErrNotConnected: errTestNotConnected}, func() (<-chan error, error) {
+		lost := make(chan error, 1)
+		connections <- lost
+		return lost, nil
+	}, listener)
+	go s.Run()
+	defer s.Close()
+
+	expectStatus(t, reported, state.Connected)
+	if err := s.EnsureConnected(); err != nil {
+		t.Fatalf("expected connection to be established, got %v", err)
+	}
+
+	(<-connections) <- errors.New("connection reset")
+	expectStatus(t, reported, state.Reconnecting)
+	expectStatus(t, reported, state.Connected)
+}
+
+func TestSupervisorRetriesFailedConnectionOnDemand(t *testing.T) {
+	attempts := make(chan struct{}, 2)
+	listener, reported := statuses()
+	s := NewSupervisor(SupervisorConfiguration{Name: "test", Attempts: 1, ErrNotConnected: errTestNotConnected}, func() (<-chan error, error) {
+		attempts <- struct{}{}
+		return nil, errors.New("connection refused")
+	}, listener)
+	go s.Run()
+	defer s.Close()
+
+	expectStatus(t, reported, state.Failed)
+	<-attempts
+
+	if err := s.EnsureConnected(); !errors.Is(err, errTestNotConnected) {
+		t.Fatalf("expected %v, got %v", errTestNotConnected, err)
+	}
+	expectStatus(t, reported, state.Connecting)
+	expectStatus(t, reported, state.Failed)
+	<-attempts
+}
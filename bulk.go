@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+
+	"DeadRabbit/replay"
+	"DeadRabbit/state"
+)
+
+// startBulkOperation applies an operation to messages in background at a configured rate, reporting each result
+// as soon as it's known, so that only confirmed messages are removed from the list
+func (sess *session) startBulkOperation(broker state.Broker, operation state.StartBulkOperation, messages []state.MessageStruct) *replay.Job {
+	return replay.Start(sess.config.Replay, messages, processor(broker, operation.Kind, operation.Destination),
+		func(result state.BulkResult) {
+			sess.store.Enqueue(state.BulkMessageProcessed{Result: result})
+		},
+		func() {
+			sess.store.Enqueue(state.BulkOperationFinished{})
+		})
+}
+
+// processMessage applies an operation to a single message in background, as publishing waits for the broker to
+// confirm it; message stays in the list, marked as processing, until the result is enqueued
+func (sess *session) processMessage(s *state.State, idx int, kind state.BulkOperationKind, destination state.Destination) {
+	s.Messages[idx].Processing = true
+	message := s.Messages[idx]
+	process := processor(sess.broker, kind, destination)
+	go func() {
+		sess.store.Enqueue(state.MessageProcessed{Kind: kind, MessageId: message.Id, Error: process(message)})
+	}()
+}
+
+// processor returns a function, which applies an operation of the kind to a message
+func processor(broker state.Broker, kind state.BulkOperationKind, destination state.Destination) func(state.MessageStruct) error {
+	return func(message state.MessageStruct) error {
+		switch kind {
+		case state.BulkRequeue:
+			return broker.RequeueMessage(message)
+		case state.BulkDrop:
+			return broker.AckMessage(message)
+		case state.BulkMove:
+			return broker.MoveMessage(message, destination)
+		default:
+			return fmt.Errorf("unknown operation %s", kind)
+		}
+	}
+}
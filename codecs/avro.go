@@ -0,0 +1,108 @@
+package codecs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/linkedin/goavro/v2"
+
+	"DeadRabbit/state"
+)
+
+// Avro decodes messages with schemas from .avsc files; a schema is chosen by its full name
+type Avro struct {
+	codecs   map[string]*goavro.Codec
+	resolver typeResolver
+}
+
+func NewAvro(directory string, resolver typeResolver) (*Avro, error) {
+	paths, err := filepath.Glob(filepath.Join(directory, "*.avsc"))
+	if err != nil {
+		return nil, err
+	}
+
+	codecs := make(map[string]*goavro.Codec, len(paths))
+	for _, path := range paths {
+		schema, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		codec, err := goavro.NewCodec(string(schema))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		var named struct {
+			Name      string
+			Namespace string
+		}
+		if err := json.Unmarshal(schema, &named); err != nil || named.Name == "" {
+			return nil, fmt.Errorf("%s: schema should be a named type", path)
+		}
+		fullName := named.Name
+		if named.Namespace != "" {
+			fullName = named.Namespace + "." + named.Name
+		}
+		codecs[fullName] = codec
+	}
+
+	return &Avro{codecs: codecs, resolver: resolver}, nil
+}
+
+func (a *Avro) Name() string {
+	return AvroFormat
+}
+
+func (a *Avro) Detects(message state.MessageStruct) bool {
+	messageType, ok := a.resolver.resolve(message, AvroFormat, "avro")
+	if ok {
+		return true
+	}
+	_, known := a.codecs[messageType]
+	return known
+}
+
+func (a *Avro) View(message state.MessageStruct) (string, error) {
+	codec, err := a.codec(message)
+	if err != nil {
+		return "", err
+	}
+
+	native, _, err := codec.NativeFromBinary([]byte(message.Body))
+	if err != nil {
+		return "", err
+	}
+	textual, err := codec.TextualFromNative(nil, native)
+	if err != nil {
+		return "", err
+	}
+	return prettifyJson(textual)
+}
+
+func (a *Avro) Encode(message state.MessageStruct, text string) (string, error) {
+	codec, err := a.codec(message)
+	if err != nil {
+		return "", err
+	}
+
+	native, _, err := codec.NativeFromTextual([]byte(text))
+	if err != nil {
+		return "", err
+	}
+	binary, err := codec.BinaryFromNative(nil, native)
+	if err != nil {
+		return "", err
+	}
+	return string(binary), nil
+}
+
+func (a *Avro) codec(message state.MessageStruct) (*goavro.Codec, error) {
+	messageType, _ := a.resolver.resolve(message, AvroFormat)
+	codec, ok := a.codecs[messageType]
+	if !ok {
+		return nil, fmt.Errorf("can't find avro schema for type %q", messageType)
+	}
+	return codec, nil
+}
@@ -0,0 +1,118 @@
+package codecs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"DeadRabbit/state"
+	"DeadRabbit/viewers"
+)
+
+const (
+	ProtobufFormat    = "protobuf"
+	AvroFormat        = "avro"
+	MessagePackFormat = "msgpack"
+)
+
+var defaultTypeHeaders = []string{"x-proto-type", "x-avro-type", "type"}
+
+type Configuration struct {
+	// DescriptorSet is a FileDescriptorSet file, e.g. produced by `protoc --include_imports -o <file>`
+	DescriptorSet string `yaml:"descriptorSet"`
+	// AvroSchemas is a directory with .avsc files; schemas are looked up by their full names
+	AvroSchemas string `yaml:"avroSchemas"`
+	// TypeHeaders are headers, a message type is taken from; "type" property is checked the last
+	TypeHeaders []string `yaml:"typeHeaders"`
+	// Queues maps queues, messages were dead-lettered from, to their format and type
+	Queues map[string]QueueMapping
+}
+
+type QueueMapping struct {
+	Format string
+	Type   string
+}
+
+// Load reads schemas and registers viewers for binary formats, so bodies are decoded in the message view and editor
+func Load(c Configuration) error {
+	resolver := typeResolver{headers: c.TypeHeaders, queues: c.Queues}
+	if len(resolver.headers) == 0 {
+		resolver.headers = defaultTypeHeaders
+	}
+
+	codecs := []viewers.Viewer{MessagePack{resolver: resolver}}
+	if c.AvroSchemas != "" {
+		avro, err := NewAvro(c.AvroSchemas, resolver)
+		if err != nil {
+			return fmt.Errorf("can't load avro schemas: %w", err)
+		}
+		codecs = append(codecs, avro)
+	}
+	if c.DescriptorSet != "" {
+		protobuf, err := NewProtobuf(c.DescriptorSet, resolver)
+		if err != nil {
+			return fmt.Errorf("can't load protobuf descriptors: %w", err)
+		}
+		codecs = append(codecs, protobuf)
+	}
+
+	viewers.Register(codecs...)
+	return nil
+}
+
+// typeResolver finds out a format and a type of a message by its headers, content type or a queue it came from
+type typeResolver struct {
+	headers []string
+	queues  map[string]QueueMapping
+}
+
+// resolve returns a type of a message in the given format, if the message is known to be in this format
+func (r typeResolver) resolve(message state.MessageStruct, format string, contentTypes ...string) (string, bool) {
+	if mapping, ok := r.queues[originQueue(message)]; ok {
+		if mapping.Format != format {
+			return "", false
+		}
+		return mapping.Type, true
+	}
+
+	messageType := r.typeOf(message)
+	for _, contentType := range contentTypes {
+		if contains(message.Properties.ContentType, contentType) {
+			return messageType, true
+		}
+	}
+	return messageType, false
+}
+
+func (r typeResolver) typeOf(message state.MessageStruct) string {
+	for _, header := range r.headers {
+		if value, ok := message.Headers[header].(string); ok && value != "" {
+			return value
+		}
+	}
+	return message.Properties.Type
+}
+
+// originQueue returns the queue, message was dead-lettered from
+func originQueue(message state.MessageStruct) string {
+	if queue := state.GroupValue(message, "x-death[0].queue"); queue != state.NoGroupValue {
+		return queue
+	}
+	if queue, ok := message.Headers["x-first-death-queue"].(string); ok {
+		return queue
+	}
+	return ""
+}
+
+func contains(contentType, fragment string) bool {
+	return strings.Contains(strings.ToLower(contentType), fragment)
+}
+
+func prettifyJson(data []byte) (string, error) {
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, data, "", "    "); err != nil {
+		return "", err
+	}
+	return pretty.String(), nil
+}
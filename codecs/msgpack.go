@@ -0,0 +1,142 @@
+package codecs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack/v5"
+
+	"DeadRabbit/commons"
+	"DeadRabbit/state"
+)
+
+// MessagePack decodes messages without any schema
+type MessagePack struct {
+	resolver typeResolver
+}
+
+func (m MessagePack) Name() string {
+	return MessagePackFormat
+}
+
+func (m MessagePack) Detects(message state.MessageStruct) bool {
+	_, ok := m.resolver.resolve(message, MessagePackFormat, "msgpack", "messagepack")
+	return ok
+}
+
+// View shows MessagePack as JSON; byte strings and timestamps are shown as objects, telling their type,
+// e.g. {"$bytes": "AP8Q"}, so they are encoded with the same types again
+func (m MessagePack) View(message state.MessageStruct) (string, error) {
+	decoder := msgpack.NewDecoder(bytes.NewReader([]byte(message.Body)))
+	decoder.SetMapDecoder(decodeStringKeyedMap)
+	value, err := decoder.DecodeInterface()
+	if err != nil {
+		return "", err
+	}
+
+	encoded, err := json.Marshal(toJsonValue(value))
+	if err != nil {
+		return "", err
+	}
+	return prettifyJson(encoded)
+}
+
+// Encode converts JSON back into MessagePack; JSON integers become integers again
+func (m MessagePack) Encode(_ state.MessageStruct, text string) (string, error) {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(text)))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return "", err
+	}
+
+	value, err := fromJsonValue(commons.FromJson(value))
+	if err != nil {
+		return "", err
+	}
+	encoded, err := msgpack.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// decodeStringKeyedMap decodes a map, refusing keys other than strings, as JSON objects couldn't have them,
+// and they would be encoded back as strings
+func decodeStringKeyedMap(decoder *msgpack.Decoder) (any, error) {
+	n, err := decoder.DecodeMapLen()
+	if err != nil || n == -1 {
+		return nil, err
+	}
+
+	result := make(map[string]any, n)
+	for i := 0; i < n; i++ {
+		key, err := decoder.DecodeInterface()
+		if err != nil {
+			return nil, err
+		}
+		name, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("map key %v is %T, only string keys could be shown as JSON", key, key)
+		}
+		if result[name], err = decoder.DecodeInterface(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// toJsonValue marks byte strings and timestamps with their types, as JSON has no types for them
+func toJsonValue(value any) any {
+	if typed, ok := commons.ToTypedJson(value); ok {
+		return typed
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for key, item := range v {
+			result[key] = toJsonValue(item)
+		}
+		return result
+	case []any:
+		result := make([]any, 0, len(v))
+		for _, item := range v {
+			result = append(result, toJsonValue(item))
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+// fromJsonValue converts objects, marked with types by toJsonValue, back into byte strings and timestamps
+func fromJsonValue(value any) (any, error) {
+	switch v := value.(type) {
+	case map[string]any:
+		if typed, ok, err := commons.FromTypedJson(v); ok {
+			return typed, err
+		}
+		result := make(map[string]any, len(v))
+		for key, item := range v {
+			decoded, err := fromJsonValue(item)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = decoded
+		}
+		return result, nil
+	case []any:
+		result := make([]any, 0, len(v))
+		for _, item := range v {
+			decoded, err := fromJsonValue(item)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, decoded)
+		}
+		return result, nil
+	default:
+		return v, nil
+	}
+}
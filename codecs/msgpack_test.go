@@ -0,0 +1,56 @@
+package codecs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+
+	"DeadRabbit/state"
+)
+
+func TestMessagePackViewIsReversible(t *testing.T) {
+	original := map[string]any{
+		"orderId":   int64(1001),
+		"signature": []byte{0x00, 0xff, 0x10},
+		"createdAt": time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		"items":     []any{map[string]any{"sku": "a-1", "checksum": []byte("raw")}},
+	}
+	body, err := msgpack.Marshal(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codec := MessagePack{}
+	view, err := codec.View(state.MessageStruct{Body: string(body)})
+	if err != nil {
+		t.Fatalf("View() error = %v", err)
+	}
+	encoded, err := codec.Encode(state.MessageStruct{}, view)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	var decoded map[string]any
+	if err := msgpack.Unmarshal([]byte(encoded), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	decoded["createdAt"] = decoded["createdAt"].(time.Time).UTC()
+	if !reflect.DeepEqual(decoded, original) {
+		t.Errorf("encoded view = %v, want %v", decoded, original)
+	}
+}
+
+func TestMessagePackViewRefusesNonStringKeys(t *testing.T) {
+	body, err := msgpack.Marshal(map[int]string{1: "one"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = MessagePack{}.View(state.MessageStruct{Body: string(body)})
+	if err == nil || !strings.Contains(err.Error(), "only string keys") {
+		t.Errorf("View() error = %v, want non-string keys to be refused", err)
+	}
+}
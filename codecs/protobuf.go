@@ -0,0 +1,110 @@
+package codecs
+
+import (
+	"fmt"
+	"os"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"DeadRabbit/state"
+)
+
+// Protobuf decodes messages with types, described by a FileDescriptorSet
+type Protobuf struct {
+	files    *protoregistry.Files
+	resolver typeResolver
+}
+
+func NewProtobuf(descriptorSetPath string, resolver typeResolver) (*Protobuf, error) {
+	content, err := os.ReadFile(descriptorSetPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(content, &set); err != nil {
+		return nil, err
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Protobuf{files: files, resolver: resolver}, nil
+}
+
+func (p *Protobuf) Name() string {
+	return ProtobufFormat
+}
+
+func (p *Protobuf) Detects(message state.MessageStruct) bool {
+	messageType, ok := p.resolver.resolve(message, ProtobufFormat, "protobuf")
+	if ok {
+		return true
+	}
+	// Type header is enough, if such type is described
+	_, err := p.descriptor(messageType)
+	return messageType != "" && err == nil
+}
+
+func (p *Protobuf) View(message state.MessageStruct) (string, error) {
+	m, err := p.newMessage(message)
+	if err != nil {
+		return "", err
+	}
+	if err := proto.Unmarshal([]byte(message.Body), m); err != nil {
+		return "", err
+	}
+
+	encoded, err := protojson.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return prettifyJson(encoded)
+}
+
+func (p *Protobuf) Encode(message state.MessageStruct, text string) (string, error) {
+	m, err := p.newMessage(message)
+	if err != nil {
+		return "", err
+	}
+	if err := protojson.Unmarshal([]byte(text), m); err != nil {
+		return "", err
+	}
+
+	encoded, err := proto.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+func (p *Protobuf) newMessage(message state.MessageStruct) (*dynamicpb.Message, error) {
+	messageType, _ := p.resolver.resolve(message, ProtobufFormat)
+	descriptor, err := p.descriptor(messageType)
+	if err != nil {
+		return nil, err
+	}
+	return dynamicpb.NewMessage(descriptor), nil
+}
+
+func (p *Protobuf) descriptor(messageType string) (protoreflect.MessageDescriptor, error) {
+	if messageType == "" {
+		return nil, fmt.Errorf("message type is unknown")
+	}
+	descriptor, err := p.files.FindDescriptorByName(protoreflect.FullName(messageType))
+	if err != nil {
+		return nil, fmt.Errorf("can't find protobuf type %s: %w", messageType, err)
+	}
+	messageDescriptor, ok := descriptor.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s isn't a protobuf message", messageType)
+	}
+	return messageDescriptor, nil
+}
@@ -0,0 +1,59 @@
+package commons
+
+type DiffKind int
+
+const (
+	Unchanged DiffKind = iota
+	Added
+	Removed
+)
+
+type DiffLine struct {
+	Kind DiffKind
+	Text string
+}
+
+// DiffLines finds the shortest line-by-line diff between two texts, using the longest common subsequence
+func DiffLines(from, to []string) []DiffLine {
+	// lcs[i][j] is a length of the longest common subsequence of from[i:] and to[j:]
+	lcs := make([][]int, len(from)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	result := make([]DiffLine, 0, len(to))
+	i, j := 0, 0
+	for i < len(from) && j < len(to) {
+		switch {
+		case from[i] == to[j]:
+			result = append(result, DiffLine{Kind: Unchanged, Text: from[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			result = append(result, DiffLine{Kind: Removed, Text: from[i]})
+			i++
+		default:
+			result = append(result, DiffLine{Kind: Added, Text: to[j]})
+			j++
+		}
+	}
+	for ; i < len(from); i++ {
+		result = append(result, DiffLine{Kind: Removed, Text: from[i]})
+	}
+	for ; j < len(to); j++ {
+		result = append(result, DiffLine{Kind: Added, Text: to[j]})
+	}
+
+	return result
+}
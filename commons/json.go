@@ -0,0 +1,68 @@
+package commons
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+)
+
+// Values, which JSON has no type for, are written as objects with a single key, telling their type,
+// e.g. {"$time": "2024-05-01T10:00:00Z"}, so they are read back with the same types
+const (
+	timeValueKey  = "$time"
+	bytesValueKey = "$bytes"
+)
+
+// FromJson converts decoded JSON numbers into integers, where possible
+func FromJson(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case []any:
+		result := make([]any, 0, len(v))
+		for _, item := range v {
+			result = append(result, FromJson(item))
+		}
+		return result
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for key, item := range v {
+			result[key] = FromJson(item)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+// ToTypedJson returns an object, marked with a type, for times and byte strings, and false for other values
+func ToTypedJson(value any) (map[string]any, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return map[string]any{timeValueKey: v.Format(time.RFC3339Nano)}, true
+	case []byte:
+		return map[string]any{bytesValueKey: base64.StdEncoding.EncodeToString(v)}, true
+	default:
+		return nil, false
+	}
+}
+
+// FromTypedJson returns a time or a byte string of an object, written by ToTypedJson, and false for other objects
+func FromTypedJson(object map[string]any) (any, bool, error) {
+	if len(object) != 1 {
+		return nil, false, nil
+	}
+	if typed, ok := object[timeValueKey].(string); ok {
+		value, err := time.Parse(time.RFC3339Nano, typed)
+		return value, true, err
+	}
+	if typed, ok := object[bytesValueKey].(string); ok {
+		value, err := base64.StdEncoding.DecodeString(typed)
+		return value, true, err
+	}
+	return nil, false, nil
+}
@@ -0,0 +1,149 @@
+package compression
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"DeadRabbit/state"
+)
+
+const (
+	Gzip    = "gzip"
+	Deflate = "deflate"
+	Zstd    = "zstd"
+	// RawDeflate is a "deflate" body without zlib wrapping; it's remembered as a compression of a message,
+	// so an edited body is compressed the same way, as it was received
+	RawDeflate = "deflate-raw"
+)
+
+// IsSupported tells, whether a body with the given content encoding could be decompressed
+func IsSupported(encoding string) bool {
+	switch normalize(encoding) {
+	case Gzip, Deflate, Zstd:
+		return true
+	default:
+		return false
+	}
+}
+
+// Decompress replaces a compressed body with a decompressed one, keeping the body as it was received,
+// so it's published back byte to byte, unless it's edited. Message is returned as is, if it isn't compressed.
+func Decompress(message state.MessageStruct) (state.MessageStruct, error) {
+	encoding := normalize(message.Properties.ContentEncoding)
+	if !IsSupported(encoding) {
+		return message, nil
+	}
+
+	body, compression, err := decompressDetected(encoding, []byte(message.Body))
+	if err != nil {
+		return message, fmt.Errorf("can't decompress %s body: %w", encoding, err)
+	}
+
+	message.Compression = compression
+	message.CompressedBody = message.Body
+	message.Body = string(body)
+	return message, nil
+}
+
+// Body returns a body to publish: the received one, if it wasn't edited, or the edited one, compressed again
+func Body(message state.MessageStruct) ([]byte, error) {
+	if message.Compression == "" {
+		return []byte(message.Body), nil
+	}
+	if message.CompressedBody != "" {
+		return []byte(message.CompressedBody), nil
+	}
+	return compress(message.Compression, []byte(message.Body))
+}
+
+// Matches tells, whether the compressed body of a message decompresses into its body, i.e. body wasn't edited since
+func Matches(message state.MessageStruct) bool {
+	if message.Compression == "" || message.CompressedBody == "" {
+		return false
+	}
+	body, _, err := decompressDetected(message.Compression, []byte(message.CompressedBody))
+	return err == nil && string(body) == message.Body
+}
+
+func normalize(encoding string) string {
+	encoding = strings.ToLower(strings.TrimSpace(encoding))
+	if encoding == "x-gzip" {
+		return Gzip
+	}
+	return encoding
+}
+
+// decompressDetected decompresses a body and returns a compression, it was actually compressed with,
+// as "deflate" is zlib-wrapped in HTTP, but raw deflate streams are used as well
+func decompressDetected(encoding string, body []byte) ([]byte, string, error) {
+	decompressed, err := decompress(encoding, body)
+	if err != nil && encoding == Deflate {
+		if raw, rawErr := decompress(RawDeflate, body); rawErr == nil {
+			return raw, RawDeflate, nil
+		}
+	}
+	return decompressed, encoding, err
+}
+
+func decompress(encoding string, body []byte) ([]byte, error) {
+	var reader io.ReadCloser
+	var err error
+	switch encoding {
+	case Gzip:
+		reader, err = gzip.NewReader(bytes.NewReader(body))
+	case Deflate:
+		reader, err = zlib.NewReader(bytes.NewReader(body))
+	case RawDeflate:
+		reader = flate.NewReader(bytes.NewReader(body))
+	case Zstd:
+		var decoder *zstd.Decoder
+		decoder, err = zstd.NewReader(bytes.NewReader(body))
+		if err == nil {
+			reader = decoder.IOReadCloser()
+		}
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %s", encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
+
+func compress(encoding string, body []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	var writer io.WriteCloser
+	var err error
+	switch encoding {
+	case Gzip:
+		writer = gzip.NewWriter(&buffer)
+	case Deflate:
+		writer = zlib.NewWriter(&buffer)
+	case RawDeflate:
+		writer, err = flate.NewWriter(&buffer, flate.DefaultCompression)
+	case Zstd:
+		writer, err = zstd.NewWriter(&buffer)
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %s", encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := writer.Write(body); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,42 @@
+package compression
+
+import (
+	"testing"
+
+	"DeadRabbit/state"
+)
+
+func TestEditedBodyIsCompressedAsReceived(t *testing.T) {
+	for _, received := range []string{Gzip, Deflate, RawDeflate, Zstd} {
+		compressed, err := compress(received, []byte("original"))
+		if err != nil {
+			t.Fatalf("%s: compress() error = %v", received, err)
+		}
+		// Raw deflate streams are labeled as "deflate" as well, as there is no content encoding for them
+		encoding := received
+		if received == RawDeflate {
+			encoding = Deflate
+		}
+
+		message, err := Decompress(state.MessageStruct{
+			Body:       string(compressed),
+			Properties: state.MessageProperties{ContentEncoding: encoding},
+		})
+		if err != nil {
+			t.Fatalf("%s: Decompress() error = %v", received, err)
+		}
+		if message.Compression != received {
+			t.Errorf("%s: compression = %s", received, message.Compression)
+		}
+
+		message.Body = "edited"
+		message.CompressedBody = ""
+		body, err := Body(message)
+		if err != nil {
+			t.Fatalf("%s: Body() error = %v", received, err)
+		}
+		if decompressed, err := decompress(received, body); err != nil || string(decompressed) != "edited" {
+			t.Errorf("%s: edited body decompresses into %q, err = %v", received, decompressed, err)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+// Package demo holds a fixture, the in-memory broker is seeded with in a demo mode
+package demo
+
+import _ "embed"
+
+// Fixture is a YAML fixture of the memory package; it's built into the binary, so demo works from any directory
+//
+//go:embed fixture.yaml
+var Fixture []byte
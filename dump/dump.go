@@ -0,0 +1,212 @@
+package dump
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"unicode/utf8"
+
+	"DeadRabbit/compression"
+	"DeadRabbit/replay"
+	"DeadRabbit/state"
+)
+
+// Base64Encoding marks bodies, which aren't valid UTF-8 texts, so they are exported byte-exact
+const Base64Encoding = "base64"
+
+// Document is a message, as it's exported: one JSON line of a JSONL file or one file of a directory
+type Document struct {
+	Body string `json:"body"`
+	// BodyEncoding is Base64Encoding for binary bodies, and empty for texts
+	BodyEncoding string `json:"bodyEncoding,omitempty"`
+	// Headers of types, which JSON has no type for, e.g. times, are objects like {"$time": "2024-05-01T10:00:00Z"}
+	Headers     map[string]any          `json:"headers,omitempty"`
+	Properties  state.MessageProperties `json:"properties"`
+	Destination state.Destination       `json:"destination"`
+	// Compression is set, when Body was decompressed, so it's compressed again on publishing
+	Compression string `json:"compression,omitempty"`
+	// CompressedBody is a body, as it was received; it's base64-encoded and is used only, while Body isn't edited
+	CompressedBody []byte `json:"compressedBody,omitempty"`
+}
+
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// FromMessage converts a message into a document; binary body is base64-encoded
+func FromMessage(message state.MessageStruct) Document {
+	document := Document{
+		Body:           message.Body,
+		Headers:        encodeHeaders(message.Headers),
+		Properties:     message.Properties,
+		Destination:    message.Destination,
+		Compression:    message.Compression,
+		CompressedBody: []byte(message.CompressedBody),
+	}
+	if !utf8.ValidString(message.Body) {
+		document.Body = base64.StdEncoding.EncodeToString([]byte(message.Body))
+		document.BodyEncoding = Base64Encoding
+	}
+	return document
+}
+
+// WriteJsonl writes messages to a file, one JSON document per line
+func WriteJsonl(path string, messages []state.MessageStruct) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	encoder.SetEscapeHTML(false)
+	for _, message := range messages {
+		if err := encoder.Encode(FromMessage(message)); err != nil {
+			return fmt.Errorf("can't export message %s: %w", message.Properties.MessageId, err)
+		}
+	}
+	return writer.Flush()
+}
+
+// WriteDirectory writes every message to a separate JSON file in the directory; files are numbered in list order
+func WriteDirectory(path string, messages []state.MessageStruct) error {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return err
+	}
+
+	for i, message := range messages {
+		var content bytes.Buffer
+		encoder := json.NewEncoder(&content)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "    ")
+		if err := encoder.Encode(FromMessage(message)); err != nil {
+			return fmt.Errorf("can't export message %s: %w", message.Properties.MessageId, err)
+		}
+		if err := os.WriteFile(filepath.Join(path, fileName(i, message)), content.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SafeFileName replaces characters, which can't be used in file names on every platform, with underscores
+func SafeFileName(name string) string {
+	return unsafeFileNameChars.ReplaceAllString(name, "_")
+}
+
+func fileName(idx int, message state.MessageStruct) string {
+	name := fmt.Sprintf("%04d", idx+1)
+	if id := SafeFileName(message.Properties.MessageId); id != "" {
+		name += "-" + id
+	}
+	return name + ".json"
+}
+
+// ToMessage converts a document back into a message, decoding a base64 body
+func (d Document) ToMessage() (state.MessageStruct, error) {
+	body := d.Body
+	switch d.BodyEncoding {
+	case "":
+	case Base64Encoding:
+		decoded, err := base64.StdEncoding.DecodeString(d.Body)
+		if err != nil {
+			return state.MessageStruct{}, fmt.Errorf("can't decode body: %w", err)
+		}
+		body = string(decoded)
+	default:
+		return state.MessageStruct{}, fmt.Errorf("unknown body encoding %s", d.BodyEncoding)
+	}
+
+	headers, err := decodeHeaders(d.Headers)
+	if err != nil {
+		return state.MessageStruct{}, err
+	}
+	message := state.MessageStruct{
+		Body:           body,
+		Headers:        headers,
+		Properties:     d.Properties,
+		Destination:    d.Destination,
+		Compression:    d.Compression,
+		CompressedBody: string(d.CompressedBody),
+		ReplayCount:    replay.Count(headers),
+	}
+	if message.CompressedBody != "" && !compression.Matches(message) {
+		// Body was edited offline, so it's compressed again on publishing
+		message.CompressedBody = ""
+	}
+	return message, nil
+}
+
+// Read reads messages from a JSONL file or from JSON files of a directory, in order of their names
+func Read(path string) ([]state.MessageStruct, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return readDirectory(path)
+	}
+	return readJsonl(path)
+}
+
+func readJsonl(path string) ([]state.MessageStruct, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	messages := make([]state.MessageStruct, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		message, err := decode(scanner.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		messages = append(messages, message)
+	}
+	return messages, scanner.Err()
+}
+
+func readDirectory(path string) ([]state.MessageStruct, error) {
+	// Glob returns names in lexical order, so numbered files keep their order
+	paths, err := filepath.Glob(filepath.Join(path, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]state.MessageStruct, 0, len(paths))
+	for _, p := range paths {
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		message, err := decode(content)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+func decode(content []byte) (state.MessageStruct, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	var document Document
+	if err := decoder.Decode(&document); err != nil {
+		return state.MessageStruct{}, err
+	}
+	return document.ToMessage()
+}
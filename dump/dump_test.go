@@ -0,0 +1,84 @@
+package dump
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+
+	"DeadRabbit/state"
+)
+
+func TestExportIsReversible(t *testing.T) {
+	died := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	message := state.MessageStruct{
+		Body: "{\"orderId\": 1001}",
+		Headers: map[string]any{
+			"x-death": []any{amqp.Table{
+				"count":        int64(2),
+				"exchange":     "orders-exchange",
+				"queue":        "orders",
+				"reason":       "rejected",
+				"routing-keys": []any{"order.created"},
+				"time":         died,
+			}},
+			"x-first-death-queue": "orders",
+			"signature":           []byte{0x00, 0xff, 0x10},
+			"retries":             int64(3),
+			"ratio":               0.5,
+			"flagged":             true,
+		},
+		Properties:  state.MessageProperties{MessageId: "order-1001", ContentType: "application/json"},
+		Destination: state.Destination{Exchange: "orders-exchange", RoutingKey: "order.created"},
+	}
+
+	for _, directory := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "export")
+		write := WriteJsonl
+		if directory {
+			write = WriteDirectory
+		}
+		if err := write(path, []state.MessageStruct{message}); err != nil {
+			t.Fatalf("write error = %v", err)
+		}
+
+		read, err := Read(path)
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		if len(read) != 1 {
+			t.Fatalf("Read() returned %d messages, want 1", len(read))
+		}
+		if !reflect.DeepEqual(read[0].Headers, message.Headers) {
+			t.Errorf("headers = %#v, want %#v", read[0].Headers, message.Headers)
+		}
+		if read[0].Body != message.Body || read[0].Properties != message.Properties ||
+			read[0].Destination != message.Destination {
+			t.Errorf("message = %+v, want %+v", read[0], message)
+		}
+	}
+}
+
+func TestReadKeepsPlainObjectsOfHandWrittenFiles(t *testing.T) {
+	document := Document{Headers: map[string]any{
+		"x-death": []any{map[string]any{"queue": "orders", "count": 1.0}},
+		"time":    "2024-05-01T10:00:00Z",
+	}}
+
+	message, err := document.ToMessage()
+	if err != nil {
+		t.Fatalf("ToMessage() error = %v", err)
+	}
+	deaths, _ := message.Headers["x-death"].([]any)
+	if len(deaths) != 1 {
+		t.Fatalf("x-death = %#v, want a single entry", message.Headers["x-death"])
+	}
+	if death, ok := deaths[0].(amqp.Table); !ok || death["queue"] != "orders" {
+		t.Errorf("x-death entry = %#v, want an AMQP table", deaths[0])
+	}
+	if value := message.Headers["time"]; value != "2024-05-01T10:00:00Z" {
+		t.Errorf("time header = %#v, want it as a string, as it isn't marked as a time", value)
+	}
+}
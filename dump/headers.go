@@ -0,0 +1,81 @@
+package dump
+
+import (
+	"fmt"
+
+	"github.com/streadway/amqp"
+
+	"DeadRabbit/commons"
+)
+
+// encodeHeaders converts headers into JSON values, marking times and byte strings with their types
+func encodeHeaders(headers map[string]any) map[string]any {
+	if headers == nil {
+		return nil
+	}
+	result := make(map[string]any, len(headers))
+	for key, value := range headers {
+		result[key] = encodeHeader(value)
+	}
+	return result
+}
+
+func encodeHeader(value any) any {
+	if typed, ok := commons.ToTypedJson(value); ok {
+		return typed
+	}
+	switch v := value.(type) {
+	case amqp.Table:
+		return encodeHeaders(v)
+	case map[string]any:
+		return encodeHeaders(v)
+	case []any:
+		result := make([]any, 0, len(v))
+		for _, item := range v {
+			result = append(result, encodeHeader(item))
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+// decodeHeaders converts JSON values back into header ones. Nested objects become AMQP tables, as brokers read
+// nested headers, e.g. entries of "x-death", as such
+func decodeHeaders(headers map[string]any) (map[string]any, error) {
+	result := make(map[string]any, len(headers))
+	for key, value := range headers {
+		decoded, err := decodeHeader(value)
+		if err != nil {
+			return nil, fmt.Errorf("can't decode header %s: %w", key, err)
+		}
+		result[key] = decoded
+	}
+	return result, nil
+}
+
+func decodeHeader(value any) (any, error) {
+	switch v := value.(type) {
+	case map[string]any:
+		if typed, ok, err := commons.FromTypedJson(v); ok {
+			return typed, err
+		}
+		table, err := decodeHeaders(v)
+		if err != nil {
+			return nil, err
+		}
+		return amqp.Table(table), nil
+	case []any:
+		result := make([]any, 0, len(v))
+		for _, item := range v {
+			decoded, err := decodeHeader(item)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, decoded)
+		}
+		return result, nil
+	default:
+		return commons.FromJson(v), nil
+	}
+}
@@ -0,0 +1,235 @@
+package editor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+
+	"DeadRabbit/commons"
+	"DeadRabbit/state"
+	"DeadRabbit/viewers"
+)
+
+const (
+	defaultEditor = "vi"
+	bodySeparator = "----- body -----"
+	commentPrefix = "#"
+	fileHeader    = `# Edit message headers (JSON object) above and message body below the separator line.
+# Lines starting with '#' above the separator are ignored. Save an empty file to cancel editing.
+`
+)
+
+var ErrCancelled = errors.New("editing was cancelled")
+
+// Edit opens message headers and body in the user's $EDITOR and returns an edited message.
+// Editor is reopened until edited content is valid. Returns ErrCancelled, if user has cleared the file.
+func Edit(message state.MessageStruct) (state.MessageStruct, error) {
+	file, err := os.CreateTemp("", "dead-rabbit-*.txt")
+	if err != nil {
+		return message, err
+	}
+	defer os.Remove(file.Name())
+
+	content, err := format(message)
+	if err != nil {
+		return message, err
+	}
+
+	for {
+		if err := os.WriteFile(file.Name(), []byte(content), 0600); err != nil {
+			return message, err
+		}
+
+		if err := runEditor(file.Name()); err != nil {
+			return message, err
+		}
+
+		editedBytes, err := os.ReadFile(file.Name())
+		if err != nil {
+			return message, err
+		}
+		content = string(editedBytes)
+
+		if strings.TrimSpace(content) == "" {
+			return message, ErrCancelled
+		}
+
+		edited, err := parse(message, content)
+		if err == nil {
+			return edited, nil
+		}
+
+		content = fmt.Sprintf("%s Error: %s\n%s", commentPrefix, err.Error(), stripErrors(content))
+	}
+}
+
+func runEditor(path string) error {
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = defaultEditor
+	}
+
+	args := strings.Fields(editor)
+	cmd := exec.Command(args[0], append(args[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func format(message state.MessageStruct) (string, error) {
+	headers, err := json.MarshalIndent(message.Headers, "", "    ")
+	if err != nil {
+		return "", fmt.Errorf("can't format headers: %w", err)
+	}
+
+	header := fileHeader
+	body := message.Body
+	if codec, ok := viewers.DetectCodec(message); ok {
+		decoded, err := codec.View(message)
+		if err != nil {
+			return "", fmt.Errorf("can't decode %s body: %w", codec.Name(), err)
+		}
+		header += fmt.Sprintf("%s Body is decoded from %s and is encoded back on save.\n", commentPrefix, codec.Name())
+		body = decoded
+	}
+
+	var prettyBody bytes.Buffer
+	if err := json.Indent(&prettyBody, []byte(body), "", "    "); err == nil {
+		body = prettyBody.String()
+	}
+
+	return header + string(headers) + "\n" + bodySeparator + "\n" + body, nil
+}
+
+func parse(original state.MessageStruct, content string) (state.MessageStruct, error) {
+	separatorIdx := strings.Index(content, "\n"+bodySeparator+"\n")
+	if separatorIdx < 0 {
+		return original, fmt.Errorf("separator line '%s' is missing", bodySeparator)
+	}
+
+	headersLines := make([]string, 0)
+	for _, line := range strings.Split(content[:separatorIdx], "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), commentPrefix) {
+			headersLines = append(headersLines, line)
+		}
+	}
+
+	headers, err := parseHeaders(original.Headers, strings.Join(headersLines, "\n"))
+	if err != nil {
+		return original, err
+	}
+
+	body, err := parseBody(original, content[separatorIdx+len(bodySeparator)+2:])
+	if err != nil {
+		return original, err
+	}
+
+	edited := original
+	edited.Headers = headers
+	edited.Body = body
+	if edited.Body != original.Body {
+		// Edited body is compressed again on publishing
+		edited.CompressedBody = ""
+	}
+	return edited, nil
+}
+
+// parseHeaders decodes edited headers; headers, which weren't changed, keep their original values and types
+func parseHeaders(original map[string]any, content string) (map[string]any, error) {
+	decoder := json.NewDecoder(strings.NewReader(content))
+	decoder.UseNumber()
+
+	edited := make(map[string]any)
+	if strings.TrimSpace(content) != "" && strings.TrimSpace(content) != "null" {
+		if err := decoder.Decode(&edited); err != nil {
+			return nil, fmt.Errorf("headers aren't a valid JSON object: %w", err)
+		}
+	}
+
+	headers := make(map[string]any, len(edited))
+	for key, value := range edited {
+		headers[key] = commons.FromJson(value)
+
+		originalValue, ok := original[key]
+		if !ok {
+			continue
+		}
+		originalJson, err := json.Marshal(originalValue)
+		if err != nil {
+			continue
+		}
+		var normalized any
+		if err := json.Unmarshal(originalJson, &normalized); err == nil {
+			var editedNormalized any
+			editedJson, _ := json.Marshal(value)
+			if err := json.Unmarshal(editedJson, &editedNormalized); err == nil && reflect.DeepEqual(normalized, editedNormalized) {
+				headers[key] = originalValue
+			}
+		}
+	}
+
+	return headers, nil
+}
+
+// parseBody validates JSON body and keeps it compact, if it was compact originally.
+// Binary bodies are encoded back, unless their decoded content wasn't changed.
+func parseBody(original state.MessageStruct, body string) (string, error) {
+	if codec, ok := viewers.DetectCodec(original); ok {
+		decoded, err := codec.View(original)
+		if err == nil && strings.TrimSpace(decoded) == strings.TrimSpace(body) {
+			return original.Body, nil
+		}
+		encoded, err := codec.Encode(original, body)
+		if err != nil {
+			return "", fmt.Errorf("can't encode body as %s: %w", codec.Name(), err)
+		}
+		return encoded, nil
+	}
+
+	if !isJson(original) {
+		// Editors usually add a line break at the end of a file
+		if !strings.HasSuffix(original.Body, "\n") {
+			body = strings.TrimSuffix(body, "\n")
+		}
+		return body, nil
+	}
+
+	if !json.Valid([]byte(body)) {
+		var value any
+		err := json.Unmarshal([]byte(body), &value)
+		return "", fmt.Errorf("body isn't a valid JSON: %w", err)
+	}
+
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, []byte(original.Body)); err == nil && compacted.String() == original.Body {
+		compacted.Reset()
+		if err := json.Compact(&compacted, []byte(body)); err == nil {
+			return compacted.String(), nil
+		}
+	}
+
+	return strings.TrimRight(body, "\n"), nil
+}
+
+func isJson(message state.MessageStruct) bool {
+	contentType := message.Properties.ContentType
+	if contentType != "" {
+		return strings.Contains(contentType, "json")
+	}
+	return json.Valid([]byte(message.Body))
+}
+
+func stripErrors(content string) string {
+	prefix := commentPrefix + " Error: "
+	lines := strings.Split(content, "\n")
+	for len(lines) > 0 && strings.HasPrefix(lines[0], prefix) {
+		lines = lines[1:]
+	}
+	return strings.Join(lines, "\n")
+}
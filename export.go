@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"DeadRabbit/commons"
+	"DeadRabbit/dump"
+	"DeadRabbit/state"
+)
+
+const exportConnectTimeout = 30 * time.Second
+
+func getExportOptions(s *state.State) []state.SelectableOption {
+	options := make([]state.SelectableOption, 0, 3)
+	if hasCurrentMessage(s) {
+		options = append(options, state.SelectableOption{Text: "Current message", Value: state.ExportCurrent})
+	}
+	if visible := len(commons.Filter(s.Messages, s.Filter.Matches)); visible > 0 {
+		text := fmt.Sprintf("All loaded messages (%d)", visible)
+		if !s.Filter.IsEmpty() {
+			text = fmt.Sprintf("Messages, matching %s (%d)", s.Filter, visible)
+		}
+		options = append(options, state.SelectableOption{Text: text, Value: state.ExportFiltered})
+	}
+	if marked := len(commons.Filter(s.Messages, isMarked)); marked > 0 {
+		options = append(options, state.SelectableOption{
+			Text:  fmt.Sprintf("Marked messages (%d)", marked),
+			Value: state.ExportMarked,
+		})
+	}
+	return options
+}
+
+func hasCurrentMessage(s *state.State) bool {
+	return s.SelectedMessageIdx >= 0 && s.SelectedMessageIdx < len(s.Messages)
+}
+
+func isMarked(m state.MessageStruct) bool {
+	return m.Selected
+}
+
+type statusChange struct {
+	status state.ConnectionStatus
+	err    error
+}
+
+// exportMessages writes messages of the scope to a new JSONL file or directory under the export directory
+func (sess *session) exportMessages(s *state.State, scope state.ExportScope, directory bool) {
+	var messages []state.MessageStruct
+	switch scope {
+	case state.ExportCurrent:
+		if hasCurrentMessage(s) {
+			messages = []state.MessageStruct{currentMessage(s)}
+		}
+	case state.ExportFiltered:
+		messages = commons.Filter(s.Messages, s.Filter.Matches)
+	case state.ExportMarked:
+		messages = commons.Filter(s.Messages, isMarked)
+	}
+	if len(messages) == 0 {
+		notify(s, "Nothing to export")
+		return
+	}
+
+	path, err := writeExport(getExportPath(sess.config, s.ActiveProfile, directory), directory, messages)
+	if err != nil {
+		log.Printf("Failed to export messages, err: %s", err.Error())
+		notify(s, "Failed to export messages: "+err.Error())
+		return
+	}
+	notify(s, fmt.Sprintf("%d messages are exported to %s", len(messages), path))
+}
+
+func getExportPath(c *configuration, profileName string, directory bool) string {
+	dir := c.Export
+	if dir == "" {
+		dir = defaultExport
+	}
+	name := dump.SafeFileName(profileName) + "-" + time.Now().Format("20060102-150405")
+	if !directory {
+		name += ".jsonl"
+	}
+	return filepath.Join(dir, name)
+}
+
+func writeExport(path string, directory bool, messages []state.MessageStruct) (string, error) {
+	if directory {
+		return path, dump.WriteDirectory(path, messages)
+	}
+	return path, dump.WriteJsonl(path, messages)
+}
+
+// runExport is an `export` subcommand: it loads a page of messages from the DLQ of a profile and writes them out.
+// Broker is used in a dry run, so messages are only browsed and are left in the DLQ.
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	profileName := flags.String("profile", "", "Profile to export messages from; the first one by default")
+	out := flags.String("out", "", "File or directory to write to; a new one in the export directory by default")
+	directory := flags.Bool("dir", false, "Write every message to a separate file in a directory, instead of JSONL")
+	filter := flags.String("filter", "", "Export only messages, which contain the text")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	p := aConfiguration.Profiles[0]
+	if *profileName != "" {
+		found := commons.Filter(aConfiguration.Profiles, func(p profile) bool {
+			return p.Name == *profileName
+		})
+		if len(found) == 0 {
+			return fmt.Errorf("profile %s isn't configured", *profileName)
+		}
+		p = found[0]
+	}
+	p = p.setDryRun(true)
+
+	statuses := make(chan statusChange, 10)
+	broker, err := newBroker(p, func(status state.ConnectionStatus, err error) {
+		select {
+		case statuses <- statusChange{status: status, err: err}:
+		default:
+			// Nobody listens, once connection is established
+		}
+	})
+	if err != nil {
+		return err
+	}
+	defer broker.Close()
+	if err := waitConnected(statuses); err != nil {
+		return err
+	}
+
+	total, err := broker.CountMessages()
+	if err != nil {
+		return err
+	}
+	messages, err := loadAllMessages(broker)
+	// Messages are released, even when loading failed half-way, so they aren't held until the broker is closed
+	if err := broker.ReleaseMessages(messages); err != nil {
+		log.Printf("Failed to release messages, err: %s", err.Error())
+	}
+	if err != nil {
+		return err
+	}
+	loaded := len(messages)
+	messages = commons.Filter(messages, state.MessageFilter{Text: *filter}.Matches)
+
+	path := *out
+	if path == "" {
+		path = getExportPath(&aConfiguration, p.Name, *directory)
+	}
+	if _, err := writeExport(path, *directory, messages); err != nil {
+		return err
+	}
+	fmt.Printf("Exported %d of %d messages to %s\n", len(messages), total, path)
+	if loaded < total {
+		fmt.Printf("%d messages weren't loaded, e.g. they are taken by another consumer\n", total-loaded)
+	}
+	return nil
+}
+
+// loadAllMessages loads pages of messages, until a page is empty
+func loadAllMessages(broker state.Broker) ([]state.MessageStruct, error) {
+	messages := make([]state.MessageStruct, 0)
+	for {
+		page := 0
+		err := broker.LoadMessages(context.Background(), func(loaded []state.MessageStruct) {
+			page += len(loaded)
+			messages = append(messages, loaded...)
+		})
+		if err != nil || page == 0 {
+			return messages, err
+		}
+	}
+}
+
+func waitConnected(statuses <-chan statusChange) error {
+	timeout := time.After(exportConnectTimeout)
+	for {
+		select {
+		case change := <-statuses:
+			switch change.status {
+			case state.Connected:
+				return nil
+			case state.Failed:
+				return fmt.Errorf("can't connect to the broker: %w", change.err)
+			}
+		case <-timeout:
+			return errors.New("can't connect to the broker in time")
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"DeadRabbit/commons"
+	"DeadRabbit/state"
+)
+
+type Action string
+
+const (
+	// Taken is recorded for every message, loaded from the broker
+	Taken Action = "taken"
+	// Released messages were given back to the DLQ
+	Released Action = "released"
+	Requeued Action = "requeued"
+	Dropped  Action = "dropped"
+	Moved    Action = "moved"
+	// Restored messages were republished to the DLQ after the session, they were taken in, had been interrupted
+	Restored Action = "restored"
+)
+
+// Key identifies a message across sessions
+type Key struct {
+	Session   string `json:"session"`
+	MessageId uint64 `json:"messageId"`
+}
+
+// Message is a message, as it was taken from the broker. Body is kept as bytes, so binary ones survive JSON encoding.
+type Message struct {
+	Body        []byte                  `json:"body"`
+	Headers     map[string]any          `json:"headers,omitempty"`
+	Properties  state.MessageProperties `json:"properties"`
+	Destination state.Destination       `json:"destination"`
+	// Compression is set, when Body was decompressed, so it's compressed again on restoring
+	Compression string `json:"compression,omitempty"`
+	// CompressedBody is a body, as it was received, so it's restored byte to byte
+	CompressedBody []byte `json:"compressedBody,omitempty"`
+}
+
+type Entry struct {
+	Key
+	At     time.Time `json:"at"`
+	Action Action    `json:"action"`
+	// Profile and Dlq are set for taken messages only
+	Profile string `json:"profile,omitempty"`
+	Dlq     string `json:"dlq,omitempty"`
+	// Owned is set, when message was taken off the broker, so it's lost, unless it's given back explicitly
+	Owned   bool     `json:"owned,omitempty"`
+	Message *Message `json:"message,omitempty"`
+}
+
+// ToMessage converts journaled message back into a state one
+func (e Entry) ToMessage() state.MessageStruct {
+	if e.Message == nil {
+		return state.MessageStruct{Id: e.MessageId}
+	}
+	return state.MessageStruct{
+		Id:             e.MessageId,
+		Body:           string(e.Message.Body),
+		Headers:        e.Message.Headers,
+		Properties:     e.Message.Properties,
+		Destination:    e.Message.Destination,
+		Compression:    e.Message.Compression,
+		CompressedBody: string(e.Message.CompressedBody),
+	}
+}
+
+// Journal is an append-only file of messages, taken from the broker, and actions, applied to them.
+// Every entry is written right away, so it survives a crash of the process. Nil journal records nothing.
+type Journal struct {
+	Session string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Open opens journal for appending; entries are recorded under a new session
+func Open(path string) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Journal{
+		Session: fmt.Sprintf("%d-%d", time.Now().UnixNano(), os.Getpid()),
+		file:    file,
+	}, nil
+}
+
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.file.Close()
+}
+
+// Taken records messages, loaded from the DLQ of the profile
+func (j *Journal) Taken(profile, dlq string, owned bool, messages []state.MessageStruct) {
+	if j == nil {
+		return
+	}
+	for _, message := range messages {
+		j.append(Entry{
+			Key:     Key{Session: j.Session, MessageId: message.Id},
+			Action:  Taken,
+			Profile: profile,
+			Dlq:     dlq,
+			Owned:   owned,
+			Message: &Message{
+				Body:           []byte(message.Body),
+				Headers:        message.Headers,
+				Properties:     message.Properties,
+				Destination:    message.Destination,
+				Compression:    message.Compression,
+				CompressedBody: []byte(message.CompressedBody),
+			},
+		})
+	}
+}
+
+// Record records an action, applied to messages of the current session
+func (j *Journal) Record(action Action, messageIds ...uint64) {
+	if j == nil {
+		return
+	}
+	for _, id := range messageIds {
+		j.append(Entry{Key: Key{Session: j.Session, MessageId: id}, Action: action})
+	}
+}
+
+// RecordKey records an action, applied to a message of any session
+func (j *Journal) RecordKey(action Action, key Key) {
+	j.append(Entry{Key: key, Action: action})
+}
+
+func (j *Journal) append(entry Entry) {
+	if j == nil {
+		return
+	}
+	entry.At = time.Now()
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Can't journal %s message %d, err: %s", entry.Action, entry.MessageId, err.Error())
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err = j.file.Write(append(line, '\n')); err != nil {
+		log.Printf("Can't journal %s message %d, err: %s", entry.Action, entry.MessageId, err.Error())
+	}
+}
+
+// Unreconciled reads the journal and returns owned messages, which were taken, but neither given back,
+// nor replayed, nor dropped. Messages, which were only browsed, are given back by the broker, once connection is lost.
+func Unreconciled(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Entry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	taken := make(map[Key]Entry)
+	order := make([]Key, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		decoder := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		decoder.UseNumber()
+		var entry Entry
+		if err := decoder.Decode(&entry); err != nil {
+			// The last line could be written partially, if process was killed
+			log.Printf("Skipping broken journal line %d, err: %s", line, err.Error())
+			continue
+		}
+
+		if entry.Action != Taken {
+			delete(taken, entry.Key)
+			continue
+		}
+		if !entry.Owned {
+			continue
+		}
+		if entry.Message != nil {
+			for key, value := range entry.Message.Headers {
+				entry.Message.Headers[key] = commons.FromJson(value)
+			}
+		}
+		taken[entry.Key] = entry
+		order = append(order, entry.Key)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]Entry, 0, len(taken))
+	for _, key := range order {
+		if entry, ok := taken[key]; ok {
+			result = append(result, entry)
+			delete(taken, key)
+		}
+	}
+	return result, nil
+}
+
+// Truncate drops all entries; it's used, when everything in the journal is reconciled, so it doesn't grow forever
+func Truncate(path string) error {
+	err := os.Truncate(path, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
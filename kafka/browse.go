@@ -0,0 +1,135 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"DeadRabbit/state"
+)
+
+// browseMessages reads the next page of messages in a dry run. Partitions are read one by one without joining
+// the consumer group, so triage sessions of the group aren't rebalanced, e.g. by export. Reading starts after
+// committed offsets of the group and goes on from offsets, browsed already, until messages are released.
+func (c *Connection) browseMessages(ctx context.Context, onLoaded func([]state.MessageStruct)) error {
+	if err := c.supervisor.EnsureConnected(); err != nil {
+		return err
+	}
+	ranges, err := c.unbrowsed(ctx)
+	if err != nil {
+		return err
+	}
+
+	batch := make([]state.MessageStruct, 0, loadBatchSize)
+	loaded := 0
+	for _, r := range ranges {
+		if loaded >= c.PageSize() {
+			break
+		}
+		if err := c.browsePartition(ctx, r, func(message state.MessageStruct) {
+			batch = append(batch, message)
+			loaded++
+			if len(batch) == loadBatchSize {
+				onLoaded(batch)
+				batch = make([]state.MessageStruct, 0, loadBatchSize)
+			}
+		}, c.PageSize()-loaded); err != nil {
+			onLoaded(batch)
+			return err
+		}
+	}
+
+	if len(batch) > 0 {
+		onLoaded(batch)
+	}
+	return ctx.Err()
+}
+
+// offsetRange is a range of a partition to read, from the first offset inclusive to the last one exclusive
+type offsetRange struct {
+	partition   int
+	first, last int64
+}
+
+// unbrowsed returns ranges of partitions, which are neither committed by the group, nor browsed yet
+func (c *Connection) unbrowsed(ctx context.Context) ([]offsetRange, error) {
+	offsets, err := c.offsets(ctx, c.config.Topic)
+	if err != nil {
+		return nil, err
+	}
+	committed, err := c.committed(ctx, c.config.Topic, offsets)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ranges := make([]offsetRange, 0, len(offsets))
+	for _, o := range offsets {
+		first := o.FirstOffset
+		if offset, ok := committed[o.Partition]; ok && offset > first {
+			first = offset
+		}
+		if offset, ok := c.browsed[o.Partition]; ok && offset > first {
+			first = offset
+		}
+		if o.LastOffset > first {
+			ranges = append(ranges, offsetRange{partition: o.Partition, first: first, last: o.LastOffset})
+		}
+	}
+	return ranges, nil
+}
+
+// browsePartition reads up to limit messages of the range with a reader, which is bound to the partition
+func (c *Connection) browsePartition(ctx context.Context, r offsetRange, onMessage func(state.MessageStruct),
+	limit int) error {
+	reader := kafkago.NewReader(kafkago.ReaderConfig{
+		Brokers:   c.config.Brokers,
+		Topic:     c.config.Topic,
+		Partition: r.partition,
+		MaxWait:   readerMaxWait,
+	})
+	defer func() {
+		if err := reader.Close(); err != nil {
+			log.Printf("Can't close a reader, err is %v", err)
+		}
+	}()
+	if err := reader.SetOffset(r.first); err != nil {
+		return err
+	}
+
+	timeout := requestTimeout
+	for read := 0; read < limit; read++ {
+		fetchCtx, cancel := context.WithTimeout(ctx, timeout)
+		msg, err := reader.FetchMessage(fetchCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+				// The rest of the range are control records of transactions, which aren't read
+				return nil
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		timeout = fetchTimeout
+
+		c.mu.Lock()
+		c.browsed[msg.Partition] = msg.Offset + 1
+		c.lastTag++
+		tag := c.lastTag
+		c.mu.Unlock()
+
+		message := c.toStateMessage(msg)
+		message.DeliveryTag = tag
+		onMessage(message)
+
+		if msg.Offset+1 >= r.last {
+			return nil
+		}
+	}
+	return nil
+}
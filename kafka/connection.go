@@ -0,0 +1,246 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"DeadRabbit/broker"
+	"DeadRabbit/replay"
+	"DeadRabbit/state"
+)
+
+const (
+	// healthCheckInterval is how often a healthy cluster is checked, as there is no long-living connection to watch
+	healthCheckInterval = 10 * time.Second
+	requestTimeout      = 10 * time.Second
+)
+
+// Connection reads a dead-letter topic as a member of a consumer group and publishes messages to other topics.
+// In a dry run, the topic is browsed without joining the group. Cluster is checked periodically and status is reported the same way as for RabbitMQ.
+type Connection struct {
+	replay.Limit
+	broker.DryRunRecorder
+
+	config     Configuration
+	supervisor *broker.Supervisor
+	client     *kafkago.Client
+	writer     *kafkago.Writer
+
+	mu     sync.Mutex
+	reader *kafkago.Reader
+	// Loaded messages are identified by synthetic delivery tags, as Kafka identifies them by partition and offset
+	lastTag    uint64
+	positions  map[uint64]position
+	partitions map[int]*partitionCursor
+	// browsed are offsets of partitions to continue browsing from in a dry run
+	browsed map[int]int64
+}
+
+type position struct {
+	partition int
+	offset    int64
+}
+
+// partitionCursor tracks messages of a partition, which were read, but whose offsets aren't committed yet
+type partitionCursor struct {
+	// fetched are offsets of read messages in order they were read
+	fetched []int64
+	// handled are offsets of acknowledged messages; they survive rereading, so messages aren't loaded twice
+	handled map[int64]bool
+}
+
+func Connect(c Configuration, listener state.StatusListener) *Connection {
+	addr := kafkago.TCP(c.Brokers...)
+	conn := &Connection{
+		Limit:          replay.Limit{Max: c.MaxReplays, OnLimit: c.OnReplayLimit},
+		DryRunRecorder: broker.DryRunRecorder{Dlq: c.Topic},
+		config:         c,
+		client:         &kafkago.Client{Addr: addr, Timeout: requestTimeout},
+		writer: &kafkago.Writer{
+			Addr:         addr,
+			Balancer:     &kafkago.Hash{},
+			RequiredAcks: kafkago.RequireAll,
+			// Messages are written one by one, so there is nothing to wait for
+			BatchSize:    1,
+			BatchTimeout: time.Millisecond,
+		},
+		positions:  make(map[uint64]position),
+		partitions: make(map[int]*partitionCursor),
+		browsed:    make(map[int]int64),
+	}
+	conn.supervisor = broker.NewSupervisor(broker.SupervisorConfiguration{
+		Name:            "Kafka",
+		Attempts:        c.ReconnectAttempts,
+		ErrNotConnected: ErrNotConnected,
+	}, conn.connect, conn.statusListener(listener))
+
+	go conn.supervisor.Run()
+
+	return conn
+}
+
+func (c *Connection) Close() {
+	c.supervisor.Close()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.resetReader(); err != nil {
+		log.Printf("Can't close a reader, err is %v", err)
+	}
+	if err := c.writer.Close(); err != nil {
+		log.Printf("Can't close a writer, err is %v", err)
+	}
+}
+
+// connect checks the cluster; as there is no long-living connection to watch, the cluster is checked periodically
+// and connection is lost, once a check fails
+func (c *Connection) connect() (<-chan error, error) {
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+
+	lost := make(chan error, 1)
+	go func() {
+		for {
+			select {
+			case <-time.After(healthCheckInterval):
+			case <-c.supervisor.Done():
+				return
+			}
+			if err := c.check(); err != nil {
+				lost <- err
+				return
+			}
+		}
+	}()
+	return lost, nil
+}
+
+// check makes sure, that the cluster is reachable and the dead-letter topic exists
+func (c *Connection) check() error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	_, err := c.partitionsOf(ctx, c.config.Topic)
+	return err
+}
+
+// statusListener resets the reader, once connection isn't established, and reports the status further
+func (c *Connection) statusListener(listener state.StatusListener) state.StatusListener {
+	return func(status state.ConnectionStatus, err error) {
+		if status != state.Connected {
+			// Loaded messages are dropped by the app, so they should be read again
+			c.mu.Lock()
+			if resetErr := c.resetReader(); resetErr != nil {
+				log.Printf("Can't close a reader, err is %v", resetErr)
+			}
+			c.mu.Unlock()
+		}
+
+		if listener != nil {
+			listener(status, err)
+		}
+	}
+}
+
+// getReader returns a reader of the dead-letter topic, creating one, which starts from committed offsets, if needed
+func (c *Connection) getReader() (*kafkago.Reader, error) {
+	if err := c.supervisor.EnsureConnected(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.reader == nil {
+		c.reader = kafkago.NewReader(kafkago.ReaderConfig{
+			Brokers:     c.config.Brokers,
+			GroupID:     c.config.groupId(),
+			Topic:       c.config.Topic,
+			StartOffset: kafkago.FirstOffset,
+			MaxWait:     readerMaxWait,
+		})
+	}
+	return c.reader, nil
+}
+
+// resetReader closes the reader, so that the next one rereads not committed messages; browsing starts over as well.
+// Should be called under lock
+func (c *Connection) resetReader() error {
+	for _, cursor := range c.partitions {
+		cursor.fetched = nil
+	}
+	c.positions = make(map[uint64]position)
+	c.browsed = make(map[int]int64)
+	if c.reader == nil {
+		return nil
+	}
+	err := c.reader.Close()
+	c.reader = nil
+	return err
+}
+
+// track remembers a read message and returns its delivery tag, unless message was acknowledged already
+func (c *Connection) track(msg kafkago.Message) (uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cursor, ok := c.partitions[msg.Partition]
+	if !ok {
+		cursor = &partitionCursor{handled: make(map[int64]bool)}
+		c.partitions[msg.Partition] = cursor
+	}
+	cursor.fetched = append(cursor.fetched, msg.Offset)
+	if cursor.handled[msg.Offset] {
+		return 0, true
+	}
+
+	c.lastTag++
+	c.positions[c.lastTag] = position{partition: msg.Partition, offset: msg.Offset}
+	return c.lastTag, false
+}
+
+// handle marks a message with the delivery tag as acknowledged and returns its partition
+func (c *Connection) handle(tag uint64) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, ok := c.positions[tag]
+	if !ok {
+		return 0, false
+	}
+	delete(c.positions, tag)
+	c.partitions[p.partition].handled[p.offset] = true
+	return p.partition, true
+}
+
+// commitHandled commits an offset of the partition up to the first message, which isn't acknowledged yet
+func (c *Connection) commitHandled(ctx context.Context, partition int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cursor := c.partitions[partition]
+	committed := int64(-1)
+	for len(cursor.fetched) > 0 && cursor.handled[cursor.fetched[0]] {
+		committed = cursor.fetched[0]
+		cursor.fetched = cursor.fetched[1:]
+	}
+	if committed < 0 || c.reader == nil {
+		return nil
+	}
+
+	// Reader commits the offset, following the given message
+	err := c.reader.CommitMessages(ctx, kafkago.Message{Topic: c.config.Topic, Partition: partition, Offset: committed})
+	if err != nil {
+		return fmt.Errorf("can't commit offset %d of %s/%d: %w", committed+1, c.config.Topic, partition, err)
+	}
+	for offset := range cursor.handled {
+		if offset <= committed {
+			delete(cursor.handled, offset)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package kafka
+
+import (
+	"strings"
+
+	"DeadRabbit/state"
+)
+
+const (
+	// ReplayToTopic publishes messages to the configured TargetTopic
+	ReplayToTopic = "topic"
+	// ReplayToOriginTopic publishes messages to the topic, they were dead-lettered from
+	ReplayToOriginTopic = "origin-topic"
+)
+
+// originTopicHeaders are set by Spring Kafka and Kafka Connect on dead-lettered messages
+var originTopicHeaders = []string{"kafka_dlt-original-topic", "__connect.errors.topic"}
+
+// dltSuffixes are conventional suffixes of dead-letter topics, which are stripped to guess a target topic
+var dltSuffixes = []string{".DLT", "-dlt", ".dlt", "_dlt", ".dlq", "-dlq"}
+
+// NamedDestination is a configured topic, messages could be moved to, e.g. a parking-lot topic
+type NamedDestination struct {
+	Name  string
+	Topic string
+}
+
+// Destination is a topic; it's kept as a routing key, as there are no exchanges in Kafka
+func (d NamedDestination) Destination() state.Destination {
+	return state.Destination{RoutingKey: d.Topic}
+}
+
+// ResolveDestination finds a topic, message should be replayed to, according to the configured replay target.
+// Target topic falls back to the dead-letter topic name without its conventional suffix.
+func (c *Connection) ResolveDestination(message state.MessageStruct) state.Destination {
+	if c.config.ReplayTarget == ReplayToOriginTopic {
+		for _, header := range originTopicHeaders {
+			if topic, ok := message.Headers[header].(string); ok && topic != "" {
+				return state.Destination{RoutingKey: topic}
+			}
+		}
+	}
+
+	if c.config.TargetTopic != "" {
+		return state.Destination{RoutingKey: c.config.TargetTopic}
+	}
+	for _, suffix := range dltSuffixes {
+		if strings.HasSuffix(c.config.Topic, suffix) {
+			return state.Destination{RoutingKey: strings.TrimSuffix(c.config.Topic, suffix)}
+		}
+	}
+	return state.Destination{}
+}
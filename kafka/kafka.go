@@ -0,0 +1,260 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"DeadRabbit/broker"
+	"DeadRabbit/compression"
+	"DeadRabbit/replay"
+	"DeadRabbit/state"
+)
+
+const (
+	defaultGroupId  = "deadrabbit"
+	defaultPageSize = 200
+	loadBatchSize   = 50
+	// firstFetchTimeout is long enough for a reader to join the consumer group
+	firstFetchTimeout = 10 * time.Second
+	// fetchTimeout is how long to wait for the next message, before the topic is considered to be read out
+	fetchTimeout   = time.Second
+	publishTimeout = 10 * time.Second
+	readerMaxWait  = 500 * time.Millisecond
+)
+
+var ErrNotConnected = errors.New("not connected to Kafka")
+
+type Configuration struct {
+	Brokers []string
+	// Topic is a dead-letter topic, messages are loaded from
+	Topic string
+	// GroupId is a consumer group, offsets of handled messages are committed for
+	GroupId string `yaml:"groupId"`
+	// TargetTopic is a topic, messages are replayed to
+	TargetTopic string `yaml:"targetTopic"`
+	// ReplayTarget is either ReplayToTopic (default) or ReplayToOriginTopic
+	ReplayTarget      string `yaml:"replayTarget"`
+	ReconnectAttempts int    `yaml:"reconnectAttempts"`
+	// PageSize is how many messages are loaded at once
+	PageSize int `yaml:"pageSize"`
+	// Destinations are topics, messages could be moved to
+	Destinations []NamedDestination
+	// MaxReplays limits how many times the same message could be replayed; zero means unlimited
+	MaxReplays int `yaml:"maxReplays"`
+	// OnReplayLimit is either replay.RefuseOnLimit (default) or replay.WarnOnLimit
+	OnReplayLimit string `yaml:"onReplayLimit"`
+	// Operator is stamped into replayed messages; "user@host" by default
+	Operator string
+	// DryRun logs mutating operations instead of sending them to the broker
+	DryRun bool `yaml:"-"`
+	// Monitor polls consumer group lag of the dead-letter topic and size of the target topic in background
+	Monitor MonitorConfiguration
+}
+
+func (c Configuration) groupId() string {
+	if c.GroupId == "" {
+		return defaultGroupId
+	}
+	return c.GroupId
+}
+
+// LoadMessages reads the next page of messages from the dead-letter topic. Messages stay in the topic:
+// only offsets of acknowledged ones are committed, so released messages are read again.
+// Nothing is committed in a dry run, so topic is browsed without joining the consumer group.
+func (c *Connection) LoadMessages(ctx context.Context, onLoaded func([]state.MessageStruct)) error {
+	if c.config.DryRun {
+		return c.browseMessages(ctx, onLoaded)
+	}
+	available, err := c.CountMessages()
+	if err != nil {
+		return err
+	}
+	if available == 0 {
+		return nil
+	}
+	reader, err := c.getReader()
+	if err != nil {
+		return err
+	}
+
+	batch := make([]state.MessageStruct, 0, loadBatchSize)
+	timeout := firstFetchTimeout
+	for loaded := 0; loaded < c.PageSize(); {
+		fetchCtx, cancel := context.WithTimeout(ctx, timeout)
+		msg, err := reader.FetchMessage(fetchCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+				// Nothing new has arrived in time, so the topic is read out
+				break
+			}
+			onLoaded(batch)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		timeout = fetchTimeout
+
+		tag, handled := c.track(msg)
+		if handled {
+			// Message was acknowledged already, but its offset couldn't be committed at that moment
+			if err := c.commitHandled(ctx, msg.Partition); err != nil {
+				log.Printf("Can't commit handled messages, err: %s", err.Error())
+			}
+			continue
+		}
+
+		message := c.toStateMessage(msg)
+		message.DeliveryTag = tag
+		batch = append(batch, message)
+		loaded++
+
+		if len(batch) == loadBatchSize {
+			onLoaded(batch)
+			batch = make([]state.MessageStruct, 0, loadBatchSize)
+		}
+	}
+
+	if len(batch) > 0 {
+		onLoaded(batch)
+	}
+	return ctx.Err()
+}
+
+// toStateMessage converts a read message, decompressing its body and resolving where to replay it to
+func (c *Connection) toStateMessage(msg kafkago.Message) state.MessageStruct {
+	message, err := compression.Decompress(toMessage(msg))
+	if err != nil {
+		// Body is kept as it was received, so it's published back untouched
+		log.Printf("Can't decompress message, err: %s", err.Error())
+		message.Error = err.Error()
+	}
+	message.Destination = c.ResolveDestination(message)
+	return message
+}
+
+// CountMessages returns a lag of the consumer group on the dead-letter topic
+func (c *Connection) CountMessages() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	return c.lag(ctx, c.config.Topic)
+}
+
+func (c *Connection) PageSize() int {
+	if c.config.PageSize <= 0 {
+		return defaultPageSize
+	}
+	return c.config.PageSize
+}
+
+// ReleaseMessages makes loaded, but not acknowledged messages to be read again,
+// by rereading the topic from committed offsets
+func (c *Connection) ReleaseMessages(_ []state.MessageStruct) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.resetReader()
+}
+
+// AckMessage marks a loaded message as handled. Offset is committed, as soon as all previous messages
+// in the partition are handled too; until then the message is skipped, if it's read again.
+func (c *Connection) AckMessage(message state.MessageStruct) error {
+	if message.DeliveryTag == 0 {
+		// Message doesn't come from the topic, e.g. it's restored or imported
+		return nil
+	}
+	if c.config.DryRun {
+		c.RecordDryRun(state.DryRunOperation{
+			Operation:   "commit",
+			MessageId:   message.Properties.MessageId,
+			DeliveryTag: message.DeliveryTag,
+		})
+		return nil
+	}
+
+	partition, ok := c.handle(message.DeliveryTag)
+	if !ok {
+		return fmt.Errorf("message %s isn't loaded from %s anymore", message.Properties.MessageId, c.config.Topic)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	return c.commitHandled(ctx, partition)
+}
+
+// RequeueMessage publishes a message to its destination, stamped with replay headers, and acknowledges it
+func (c *Connection) RequeueMessage(message state.MessageStruct) error {
+	if err := c.Limit.Check(message); err != nil {
+		return err
+	}
+	message.Headers = replay.Stamp(message, c.config.Operator)
+	if err := c.publish(message.Destination.RoutingKey, message); err != nil {
+		return err
+	}
+
+	return c.AckMessage(message)
+}
+
+// MoveMessage publishes a message as is to the topic of the destination, marking where it was moved from,
+// and acknowledges it
+func (c *Connection) MoveMessage(message state.MessageStruct, destination state.Destination) error {
+	message.Headers = broker.MarkMovedFrom(message.Headers, c.config.Topic)
+
+	if err := c.publish(destination.RoutingKey, message); err != nil {
+		return err
+	}
+
+	return c.AckMessage(message)
+}
+
+// RestoreMessages publishes messages back to the dead-letter topic as they are
+func (c *Connection) RestoreMessages(messages []state.MessageStruct) error {
+	for _, message := range messages {
+		if err := c.publish(c.config.Topic, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsBrowsing is always true, as reading a topic doesn't remove messages from it
+func (c *Connection) IsBrowsing() bool {
+	return true
+}
+
+func (c *Connection) Destinations() []NamedDestination {
+	return c.config.Destinations
+}
+
+// publish writes a message to the topic and waits until all in-sync replicas have it
+func (c *Connection) publish(topic string, message state.MessageStruct) error {
+	if topic == "" {
+		return fmt.Errorf("can't resolve where to replay the message to")
+	}
+	if c.config.DryRun {
+		c.RecordDryRun(state.DryRunOperation{
+			Operation:  "publish",
+			RoutingKey: topic,
+			MessageId:  message.Properties.MessageId,
+		})
+		return nil
+	}
+	if err := c.supervisor.EnsureConnected(); err != nil {
+		return err
+	}
+
+	msg, err := toKafkaMessage(topic, message)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	if err := c.writer.WriteMessages(ctx, msg); err != nil {
+		return fmt.Errorf("can't publish to %s: %w", topic, err)
+	}
+	return nil
+}
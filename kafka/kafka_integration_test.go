@@ -0,0 +1,205 @@
+//go:build integration
+
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"DeadRabbit/state"
+)
+
+// Integration tests run against brokers from KAFKA_BROKERS, e.g. a single-node one of kafka/docker-compose.yaml:
+//
+//	docker compose -f kafka/docker-compose.yaml up -d
+//	KAFKA_BROKERS=localhost:9092 go test -tags integration ./kafka
+
+func brokers(t *testing.T) []string {
+	t.Helper()
+	value := os.Getenv("KAFKA_BROKERS")
+	if value == "" {
+		t.Skip("KAFKA_BROKERS isn't set")
+	}
+	return strings.Split(value, ",")
+}
+
+// newTopic creates a single-partition topic with the given messages, so they are read in order
+func newTopic(t *testing.T, brokers []string, bodies ...string) string {
+	t.Helper()
+	topic := fmt.Sprintf("deadrabbit-test-%d.DLT", time.Now().UnixNano())
+	client := &kafkago.Client{Addr: kafkago.TCP(brokers...), Timeout: requestTimeout}
+	response, err := client.CreateTopics(context.Background(), &kafkago.CreateTopicsRequest{
+		Topics: []kafkago.TopicConfig{{Topic: topic, NumPartitions: 1, ReplicationFactor: 1}},
+	})
+	if err != nil {
+		t.Fatalf("Can't create topic %s: %v", topic, err)
+	}
+	if err := response.Errors[topic]; err != nil {
+		t.Fatalf("Can't create topic %s: %v", topic, err)
+	}
+	produce(t, brokers, topic, bodies...)
+	return topic
+}
+
+func produce(t *testing.T, brokers []string, topic string, bodies ...string) {
+	t.Helper()
+	writer := &kafkago.Writer{
+		Addr:         kafkago.TCP(brokers...),
+		Topic:        topic,
+		RequiredAcks: kafkago.RequireAll,
+	}
+	defer writer.Close()
+
+	messages := make([]kafkago.Message, 0, len(bodies))
+	for _, body := range bodies {
+		messages = append(messages, kafkago.Message{Value: []byte(body)})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	if err := writer.WriteMessages(ctx, messages...); err != nil {
+		t.Fatalf("Can't produce to %s: %v", topic, err)
+	}
+}
+
+// connect returns a connection, once it has checked the cluster
+func connect(t *testing.T, c Configuration) *Connection {
+	t.Helper()
+	c.Monitor.Interval = -1
+	connected := make(chan struct{}, 1)
+	conn := Connect(c, func(status state.ConnectionStatus, err error) {
+		if status == state.Connected {
+			connected <- struct{}{}
+		}
+	})
+	t.Cleanup(conn.Close)
+
+	select {
+	case <-connected:
+	case <-time.After(30 * time.Second):
+		t.Fatal("Can't connect to Kafka")
+	}
+	return conn
+}
+
+func load(t *testing.T, conn *Connection) []state.MessageStruct {
+	t.Helper()
+	loaded := make([]state.MessageStruct, 0)
+	if err := conn.LoadMessages(context.Background(), func(messages []state.MessageStruct) {
+		loaded = append(loaded, messages...)
+	}); err != nil {
+		t.Fatalf("LoadMessages() error = %v", err)
+	}
+	return loaded
+}
+
+func bodies(messages []state.MessageStruct) []string {
+	result := make([]string, 0, len(messages))
+	for _, m := range messages {
+		result = append(result, m.Body)
+	}
+	return result
+}
+
+func assertBodies(t *testing.T, messages []state.MessageStruct, want ...string) {
+	t.Helper()
+	if got := bodies(messages); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("loaded %v, want %v", got, want)
+	}
+}
+
+func assertCount(t *testing.T, conn *Connection, want int) {
+	t.Helper()
+	count, err := conn.CountMessages()
+	if err != nil {
+		t.Fatalf("CountMessages() error = %v", err)
+	}
+	if count != want {
+		t.Errorf("CountMessages() = %d, want %d", count, want)
+	}
+}
+
+func TestAckCommitsHandledOffsets(t *testing.T) {
+	brokers := brokers(t)
+	topic := newTopic(t, brokers, "first", "second", "third")
+	conn := connect(t, Configuration{Brokers: brokers, Topic: topic, GroupId: topic + "-group"})
+
+	loaded := load(t, conn)
+	assertBodies(t, loaded, "first", "second", "third")
+	assertCount(t, conn, 3)
+
+	if err := conn.AckMessage(loaded[0]); err != nil {
+		t.Fatalf("AckMessage() error = %v", err)
+	}
+	assertCount(t, conn, 2)
+
+	// Offset of the third message can't be committed, while the second one isn't handled
+	if err := conn.AckMessage(loaded[2]); err != nil {
+		t.Fatalf("AckMessage() error = %v", err)
+	}
+	assertCount(t, conn, 2)
+}
+
+func TestReleaseRereadsSkippingHandledOffsets(t *testing.T) {
+	brokers := brokers(t)
+	topic := newTopic(t, brokers, "first", "second", "third")
+	conn := connect(t, Configuration{Brokers: brokers, Topic: topic, GroupId: topic + "-group"})
+
+	loaded := load(t, conn)
+	assertBodies(t, loaded, "first", "second", "third")
+	if err := conn.AckMessage(loaded[2]); err != nil {
+		t.Fatalf("AckMessage() error = %v", err)
+	}
+
+	if err := conn.ReleaseMessages(loaded[:2]); err != nil {
+		t.Fatalf("ReleaseMessages() error = %v", err)
+	}
+	reloaded := load(t, conn)
+	assertBodies(t, reloaded, "first", "second")
+
+	for _, message := range reloaded {
+		if err := conn.AckMessage(message); err != nil {
+			t.Fatalf("AckMessage() error = %v", err)
+		}
+	}
+	assertCount(t, conn, 0)
+	assertBodies(t, load(t, conn))
+}
+
+func TestDryRunBrowsesWithoutCommitting(t *testing.T) {
+	brokers := brokers(t)
+	topic := newTopic(t, brokers, "first", "second", "third")
+	group := topic + "-group"
+
+	// The group has committed the first message, so browsing starts after it
+	triage := connect(t, Configuration{Brokers: brokers, Topic: topic, GroupId: group, PageSize: 1})
+	first := load(t, triage)
+	assertBodies(t, first, "first")
+	if err := triage.AckMessage(first[0]); err != nil {
+		t.Fatalf("AckMessage() error = %v", err)
+	}
+
+	conn := connect(t, Configuration{Brokers: brokers, Topic: topic, GroupId: group, PageSize: 1, DryRun: true})
+	assertBodies(t, load(t, conn), "second")
+	browsed := load(t, conn)
+	assertBodies(t, browsed, "third")
+	assertBodies(t, load(t, conn))
+
+	if err := conn.AckMessage(browsed[0]); err != nil {
+		t.Fatalf("AckMessage() error = %v", err)
+	}
+	assertCount(t, conn, 2)
+	if len(conn.DryRunOperations()) != 1 {
+		t.Errorf("DryRunOperations() = %v, want a single commit", conn.DryRunOperations())
+	}
+
+	if err := conn.ReleaseMessages(browsed); err != nil {
+		t.Fatalf("ReleaseMessages() error = %v", err)
+	}
+	assertBodies(t, load(t, conn), "second")
+}
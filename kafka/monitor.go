@@ -0,0 +1,150 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"DeadRabbit/broker"
+	"DeadRabbit/state"
+)
+
+type MonitorConfiguration struct {
+	// Interval is how often topics are inspected, in seconds; Negative value disables monitoring
+	Interval int
+	// Alert notifies about new messages, which have arrived to the dead-letter topic
+	Alert bool
+}
+
+// MonitorQueues periodically inspects the dead-letter topic and the target topic, until connection is closed.
+// Messages of the dead-letter topic are ones, not committed by the consumer group yet.
+func (c *Connection) MonitorQueues(listener state.StatsListener) {
+	broker.MonitorQueues(c.config.Monitor.Interval, c.supervisor.Done(),
+		broker.Queue{Name: c.config.Topic, Inspect: c.inspector(c.config.Topic, c.lag)},
+		broker.Queue{Name: c.config.TargetTopic, Inspect: c.inspector(c.config.TargetTopic, c.size)},
+		listener)
+}
+
+// inspector counts messages of the topic; topics have no consumers to report
+func (c *Connection) inspector(topic string, count func(ctx context.Context, topic string) (int, error)) func() (int, int, error) {
+	return func() (int, int, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		defer cancel()
+		messages, err := count(ctx, topic)
+		return messages, 0, err
+	}
+}
+
+// lag returns number of messages in the topic after offsets, committed by the consumer group
+func (c *Connection) lag(ctx context.Context, topic string) (int, error) {
+	offsets, err := c.offsets(ctx, topic)
+	if err != nil {
+		return 0, err
+	}
+
+	committed, err := c.committed(ctx, topic, offsets)
+	if err != nil {
+		return 0, err
+	}
+
+	lag := int64(0)
+	for _, o := range offsets {
+		start := o.FirstOffset
+		if offset, ok := committed[o.Partition]; ok && offset > start {
+			start = offset
+		}
+		if o.LastOffset > start {
+			lag += o.LastOffset - start
+		}
+	}
+	return int(lag), nil
+}
+
+// committed returns offsets of partitions, committed by the consumer group; it's -1 for partitions without commits
+func (c *Connection) committed(ctx context.Context, topic string, offsets []kafkago.PartitionOffsets) (map[int]int64, error) {
+	partitions := make([]int, 0, len(offsets))
+	for _, o := range offsets {
+		partitions = append(partitions, o.Partition)
+	}
+	response, err := c.client.OffsetFetch(ctx, &kafkago.OffsetFetchRequest{
+		GroupID: c.config.groupId(),
+		Topics:  map[string][]int{topic: partitions},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if response.Error != nil {
+		return nil, response.Error
+	}
+	committed := make(map[int]int64, len(partitions))
+	for _, p := range response.Topics[topic] {
+		if p.Error != nil {
+			return nil, p.Error
+		}
+		committed[p.Partition] = p.CommittedOffset
+	}
+	return committed, nil
+}
+
+// size returns number of messages, retained in the topic
+func (c *Connection) size(ctx context.Context, topic string) (int, error) {
+	offsets, err := c.offsets(ctx, topic)
+	if err != nil {
+		return 0, err
+	}
+
+	size := int64(0)
+	for _, o := range offsets {
+		size += o.LastOffset - o.FirstOffset
+	}
+	return int(size), nil
+}
+
+// offsets returns the first and the last offsets of every partition of the topic
+func (c *Connection) offsets(ctx context.Context, topic string) ([]kafkago.PartitionOffsets, error) {
+	partitions, err := c.partitionsOf(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	requests := make([]kafkago.OffsetRequest, 0, 2*len(partitions))
+	for _, p := range partitions {
+		requests = append(requests, kafkago.FirstOffsetOf(p), kafkago.LastOffsetOf(p))
+	}
+	response, err := c.client.ListOffsets(ctx, &kafkago.ListOffsetsRequest{
+		Topics: map[string][]kafkago.OffsetRequest{topic: requests},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	offsets := response.Topics[topic]
+	for _, o := range offsets {
+		if o.Error != nil {
+			return nil, fmt.Errorf("can't list offsets of %s/%d: %w", topic, o.Partition, o.Error)
+		}
+	}
+	return offsets, nil
+}
+
+func (c *Connection) partitionsOf(ctx context.Context, topic string) ([]int, error) {
+	response, err := c.client.Metadata(ctx, &kafkago.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range response.Topics {
+		if t.Name != topic {
+			continue
+		}
+		if t.Error != nil {
+			return nil, t.Error
+		}
+		partitions := make([]int, 0, len(t.Partitions))
+		for _, p := range t.Partitions {
+			partitions = append(partitions, p.ID)
+		}
+		return partitions, nil
+	}
+	return nil, fmt.Errorf("topic %s doesn't exist", topic)
+}
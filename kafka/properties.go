@@ -0,0 +1,105 @@
+package kafka
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"DeadRabbit/compression"
+	"DeadRabbit/replay"
+	"DeadRabbit/state"
+)
+
+// Kafka has no message properties, so the common ones are carried in headers
+var (
+	contentTypeHeaders     = []string{"content-type", "contentType"}
+	contentEncodingHeaders = []string{"content-encoding", "contentEncoding"}
+)
+
+func toMessage(m kafkago.Message) state.MessageStruct {
+	headers := make(map[string]any, len(m.Headers))
+	for _, header := range m.Headers {
+		headers[header.Key] = string(header.Value)
+	}
+
+	return state.MessageStruct{
+		Body:    string(m.Value),
+		Headers: headers,
+		Properties: state.MessageProperties{
+			ContentType:     firstHeader(headers, contentTypeHeaders),
+			ContentEncoding: firstHeader(headers, contentEncodingHeaders),
+			MessageId:       fmt.Sprintf("%s-%d@%d", m.Topic, m.Partition, m.Offset),
+			Timestamp:       m.Time,
+			Key:             string(m.Key),
+		},
+		ReplayCount: replay.Count(headers),
+	}
+}
+
+// toKafkaMessage converts a message back; headers are written in a stable order, so repeated publishing is the same
+func toKafkaMessage(topic string, message state.MessageStruct) (kafkago.Message, error) {
+	body, err := compression.Body(message)
+	if err != nil {
+		return kafkago.Message{}, err
+	}
+
+	keys := make([]string, 0, len(message.Headers))
+	for key := range message.Headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	headers := make([]kafkago.Header, 0, len(keys))
+	for _, key := range keys {
+		value, err := toHeaderValue(message.Headers[key])
+		if err != nil {
+			return kafkago.Message{}, fmt.Errorf("can't convert header %s: %w", key, err)
+		}
+		headers = append(headers, kafkago.Header{Key: key, Value: value})
+	}
+
+	msg := kafkago.Message{
+		Topic:   topic,
+		Value:   body,
+		Headers: headers,
+	}
+	if message.Properties.Key != "" {
+		msg.Key = []byte(message.Properties.Key)
+	}
+	return msg, nil
+}
+
+// toHeaderValue converts a header value to bytes; Kafka headers are just byte strings
+func toHeaderValue(value any) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	case time.Time:
+		return []byte(v.Format(time.RFC3339Nano)), nil
+	case int:
+		return []byte(strconv.Itoa(v)), nil
+	case int64:
+		return []byte(strconv.FormatInt(v, 10)), nil
+	case bool, int8, int16, int32, uint8, uint16, uint32, uint64, float32, float64:
+		return []byte(fmt.Sprint(v)), nil
+	default:
+		return json.Marshal(v)
+	}
+}
+
+func firstHeader(headers map[string]any, names []string) string {
+	for _, name := range names {
+		if value, ok := headers[name].(string); ok && value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -16,6 +16,7 @@ var viewsNames = map[string]string{
 	listViewName:       "DLQ List",
 	detailsViewName:    "Message",
 	sqlResultsViewName: "SQL Results",
+	groupsViewName:     "Groups",
 }
 
 var borderStyle = tcell.StyleDefault.Foreground(tcell.ColorWhite).Background(tcell.ColorDefault)
@@ -194,6 +195,16 @@ func (l *Layout) drawViewsNames() {
 			continue
 		}
 
+		if viewName == listViewName {
+			name += getMessageListTitleSuffix(l.store.GetCurrent())
+		}
+		if viewName == detailsViewName {
+			name += getMessageDetailsTitleSuffix(l.store.GetCurrent())
+		}
+		if viewName == groupsViewName {
+			name += getMessageGroupsTitleSuffix(l.store.GetCurrent())
+		}
+
 		vWidth, _ := v.getSize()
 		x, y := v.getOffset()
 
@@ -202,14 +213,15 @@ func (l *Layout) drawViewsNames() {
 			aStyle = selectedNameStyle
 		}
 
-		if len(name) > vWidth-2 {
-			name = name[0 : vWidth-2]
+		nameRunes := []rune(name)
+		if len(nameRunes) > vWidth-2 {
+			nameRunes = nameRunes[0 : vWidth-2]
 		}
 		l.screen.SetContent(x, y-1, '╡', nil, borderStyle)
-		for i, r := range []rune(name) {
+		for i, r := range nameRunes {
 			dx := i + 1
 			l.screen.SetContent(x+dx, y-1, r, nil, aStyle)
 		}
-		l.screen.SetContent(x+len(name)+1, y-1, '╞', nil, borderStyle)
+		l.screen.SetContent(x+len(nameRunes)+1, y-1, '╞', nil, borderStyle)
 	}
 }
@@ -3,19 +3,34 @@ package layout
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/gdamore/tcell"
+
+	"DeadRabbit/state"
 )
 
+const notificationTimeout = 10 * time.Second
+
 var (
-	style = tcell.StyleDefault.Background(tcell.ColorWhite).Foreground(tcell.ColorBlack)
+	notificationStyle = tcell.StyleDefault.Background(tcell.ColorDarkBlue).Foreground(tcell.ColorWhite)
+	style             = tcell.StyleDefault.Background(tcell.ColorWhite).Foreground(tcell.ColorBlack)
+	statsStyle        = style.Background(tcell.ColorLightGray)
+
+	brokerStatusStyles = map[state.ConnectionStatus]tcell.Style{
+		state.Connecting:   style.Background(tcell.ColorYellow),
+		state.Connected:    style.Background(tcell.ColorGreen),
+		state.Reconnecting: style.Background(tcell.ColorYellow),
+		state.Failed:       style.Background(tcell.ColorRed).Foreground(tcell.ColorWhite),
+	}
 )
 
 type ControlsView struct {
 }
 
 func (v *ControlsView) Draw(c DrawingContext) error {
-	actions := c.GetState().AppActions
+	s := c.GetState()
+	actions := s.AppActions
 
 	actionsStr := strings.Builder{}
 
@@ -25,18 +40,66 @@ func (v *ControlsView) Draw(c DrawingContext) error {
 
 	width, _ := c.GetSize()
 	runes := []rune(actionsStr.String())
+	status := fmt.Sprintf(" %s: %s ", s.ActiveProfile, s.BrokerStatus.Status)
+	if s.DryRun {
+		status = " DRY RUN |" + status
+	}
+	statusRunes := []rune(status)
+	statusX := width - len(statusRunes)
+
+	statsRunes := []rune(getQueueStatsLine(s))
+	statsX := statusX - len(statsRunes)
+
+	notificationX := statsX
+	var notificationRunes []rune
+	if s.Notification != nil && time.Since(s.Notification.At) < notificationTimeout {
+		notificationRunes = []rune(fmt.Sprintf(" %s ", s.Notification.Value))
+		notificationX = statusX - len(notificationRunes)
+	}
 
 	for i := 0; i < width; i++ {
 		r := ' '
-		if len(runes) > i {
+		aStyle := style
+		if i >= statusX {
+			r = statusRunes[i-statusX]
+			aStyle = brokerStatusStyles[s.BrokerStatus.Status]
+		} else if i >= statsX {
+			r = statsRunes[i-statsX]
+			aStyle = statsStyle
+		} else if i >= notificationX && i-notificationX < len(notificationRunes) {
+			r = notificationRunes[i-notificationX]
+			aStyle = notificationStyle
+		} else if len(runes) > i {
 			r = runes[i]
 		}
-		c.SetCell(i, 0, style, r)
+		c.SetCell(i, 0, aStyle, r)
 	}
 
 	return nil
 }
 
+// getQueueStatsLine describes DLQ and target queue, as they were seen by the monitor last time
+func getQueueStatsLine(s *state.State) string {
+	if s.DlqStats.At.IsZero() {
+		return ""
+	}
+
+	line := strings.Builder{}
+	line.WriteString(fmt.Sprintf(" DLQ %s", formatThousands(s.DlqStats.Messages)))
+	if s.DlqStats.Rate >= 0.05 || s.DlqStats.Rate <= -0.05 {
+		line.WriteString(fmt.Sprintf(" (%+.1f/s)", s.DlqStats.Rate))
+	}
+	if s.DlqStats.Error != "" {
+		line.WriteString(" (stale)")
+	}
+	if !s.TargetQueueStats.At.IsZero() {
+		line.WriteString(fmt.Sprintf(" │ %s %s, %d consumer(s)", s.TargetQueueStats.Name,
+			formatThousands(s.TargetQueueStats.Messages), s.TargetQueueStats.Consumers))
+	}
+	line.WriteString(" ")
+	return line.String()
+}
+
 func (v *ControlsView) GetName() string {
 	return "controls"
 }
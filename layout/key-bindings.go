@@ -11,6 +11,12 @@ import (
 
 var keyNames = tcell.KeyNames
 
+var modNames = map[tcell.ModMask]string{
+	tcell.ModShift: "⇧",
+	tcell.ModCtrl:  "^",
+	tcell.ModAlt:   "⌥",
+}
+
 func init() {
 	keyNames[tcell.KeyUp] = "↑"
 	keyNames[tcell.KeyDown] = "↓"
@@ -20,6 +26,7 @@ func init() {
 
 type KeyBinding struct {
 	key     tcell.Key
+	mod     tcell.ModMask
 	ch      *rune
 	handler KeyBindingHandler
 	name    string
@@ -35,7 +42,8 @@ type KeyBindingHandler = func(ev *tcell.EventKey, ctx KeyBindingContext)
 
 func (b KeyBinding) Matches(event tcell.EventKey) bool {
 	return event.Key() == b.key &&
-		(b.ch == nil || *b.ch == event.Rune())
+		(b.ch == nil || *b.ch == event.Rune()) &&
+		event.Modifiers()&b.mod == b.mod
 }
 
 func NewFuncKeyBinding(name string, hidden bool, key tcell.Key, handler KeyBindingHandler) *KeyBinding {
@@ -48,6 +56,19 @@ func NewFuncKeyBinding(name string, hidden bool, key tcell.Key, handler KeyBindi
 	}
 }
 
+// NewModFuncKeyBinding creates a binding for a key, pressed along with modifiers, e.g. Shift+↓.
+// It should be listed before a binding for the same key without modifiers, as the first matching binding is used
+func NewModFuncKeyBinding(name string, hidden bool, mod tcell.ModMask, key tcell.Key, handler KeyBindingHandler) *KeyBinding {
+	return &KeyBinding{
+		key:     key,
+		mod:     mod,
+		ch:      nil,
+		hidden:  hidden,
+		handler: handler,
+		name:    fmt.Sprintf("[%s%s]%s", modNames[mod], keyNames[key], name),
+	}
+}
+
 func NewRuneKeyBinding(name string, hidden bool, key rune, handler KeyBindingHandler) *KeyBinding {
 	return &KeyBinding{
 		key:     tcell.KeyRune,
@@ -1,12 +1,15 @@
 package layout
 
 import (
+	"errors"
 	"log"
 	"sort"
+	"time"
 
 	"github.com/gdamore/tcell"
 
 	"DeadRabbit/commons"
+	"DeadRabbit/editor"
 	"DeadRabbit/state"
 	"DeadRabbit/store"
 )
@@ -15,8 +18,12 @@ const (
 	listViewName       = "messages-list"
 	detailsViewName    = "message-details"
 	sqlResultsViewName = "sql-results"
+	groupsViewName     = "message-groups"
 	controlsViewName   = "controls"
 	DefaultView        = listViewName
+	// exitTimeout limits waiting for loading and a bulk operation to finish on exit; messages, which weren't
+	// released, stay in journal
+	exitTimeout = 5 * time.Second
 )
 
 type DrawingContext interface {
@@ -73,11 +80,15 @@ type Layout struct {
 	views          map[string]*viewDescriptor
 	store          *store.Store[state.State]
 	screen         tcell.Screen
+	screenEvents   chan tcell.Event
 	globalBindings []*KeyBinding
+	exit           func()
+	// exitDeadline is set, once exit is requested
+	exitDeadline time.Time
 }
 
 func (l *Layout) Show() {
-	screenEvents := make(chan tcell.Event, 10)
+	screenEvents := l.screenEvents
 
 	l.store.AddReducer(l.handleStoreEvents)
 
@@ -111,9 +122,37 @@ func (l *Layout) Show() {
 			}
 		case newState := <-stateUpdates:
 			l.draw(newState)
+		case action := <-l.store.Queued():
+			l.store.Dispatch(action)
 		default:
 		}
+		if l.tryExit() {
+			return
+		}
+	}
+}
+
+// tryExit releases messages and exits, once exit is requested and loading, a bulk operation and operations on single
+// messages are finished. Batches, which were loaded before cancelling, are queued ahead of LoadingFinished, so they
+// are released too; results of a bulk operation are queued ahead of BulkOperationFinished, so processed messages
+// aren't released
+func (l *Layout) tryExit() bool {
+	if l.exitDeadline.IsZero() {
+		return false
+	}
+	current := l.store.GetCurrent()
+	busy := current.LoadingMessages || (current.BulkOperation != nil && !current.BulkOperation.IsFinished()) ||
+		current.IsProcessingMessages()
+	if busy && time.Now().Before(l.exitDeadline) {
+		return false
+	}
+	if busy {
+		log.Printf("Loading or processing messages isn't finished in %s, exiting without releasing messages", exitTimeout)
+	} else if len(current.Messages) > 0 {
+		l.store.Dispatch(state.ReleaseMessages{})
 	}
+	l.exit()
+	return true
 }
 
 func (l *Layout) tryHandleKeyEvent(screenEvent *tcell.EventKey, bindings []*KeyBinding, width, height int) bool {
@@ -188,26 +227,17 @@ reduceSwitch:
 		s.FocusedViews.Push(action.ViewName)
 
 		recalculateActions(s, l)
+	case state.Exit:
+		if l.exitDeadline.IsZero() {
+			l.exitDeadline = time.Now().Add(exitTimeout)
+		}
 	case state.ShowQueriesListPopup:
 		const popupName = "query-list-popup"
 		// Just hide queries popup, if it's showing
-		if _, ok := l.views[popupName]; ok {
-			delete(l.views, popupName)
-			s.FocusedViews.Pop()
-			l.views[s.FocusedViews.Top()].focused = true
-			recalculateActions(s, l)
+		if l.hidePopup(s, popupName) {
 			break
 		}
 
-		// Hide another popups, if any; Unfocus other views
-		for key, descriptor := range l.views {
-			descriptor.focused = false
-			if _, ok := descriptor.view.(*Popup); ok {
-				delete(l.views, key)
-				s.FocusedViews.Pop()
-			}
-		}
-
 		s.SelectQueryPopup.SelectedIdx = 0
 
 		aPopup := NewBuilder().
@@ -226,49 +256,22 @@ reduceSwitch:
 			}).
 			Build()
 
-		s.FocusedViews.Push(popupName)
-		l.views[popupName] = &viewDescriptor{
-			view: aPopup,
-			getOffset: func() (dx, dy int) {
-				return 0, 0
-			},
-			getSize: func() (int, int) {
-				return l.screen.Size()
-			},
-			focused:    true,
-			focusOrder: -1,
-			externalKeyBindings: []*KeyBinding{
-				NewFuncKeyBinding("Next option", true, tcell.KeyDown, func(ev *tcell.EventKey, ctx KeyBindingContext) {
-					ctx.store.Dispatch(state.QueriesListNextOption{})
-				}),
-				NewFuncKeyBinding("Prev option", true, tcell.KeyUp, func(ev *tcell.EventKey, ctx KeyBindingContext) {
-					ctx.store.Dispatch(state.QueriesListPrevOption{})
-				}),
-			},
-		}
-
-		recalculateActions(s, l)
+		l.showPopup(s, aPopup, []*KeyBinding{
+			NewFuncKeyBinding("Next option", true, tcell.KeyDown, func(ev *tcell.EventKey, ctx KeyBindingContext) {
+				ctx.store.Dispatch(state.QueriesListNextOption{})
+			}),
+			NewFuncKeyBinding("Prev option", true, tcell.KeyUp, func(ev *tcell.EventKey, ctx KeyBindingContext) {
+				ctx.store.Dispatch(state.QueriesListPrevOption{})
+			}),
+		})
 		l.store.Dispatch(state.ForceRedraw{})
 	case state.ShowFillQueryParamsPopup:
 		const popupName = "fill-query-params-popup"
 		// Just hide queries popup, if it's showing
-		if _, ok := l.views[popupName]; ok {
-			delete(l.views, popupName)
-			s.FocusedViews.Pop()
-			l.views[s.FocusedViews.Top()].focused = true
-			recalculateActions(s, l)
+		if l.hidePopup(s, popupName) {
 			break
 		}
 
-		// Hide another popups, if any; Unfocus other views
-		for key, descriptor := range l.views {
-			descriptor.focused = false
-			if _, ok := descriptor.view.(*Popup); ok {
-				delete(l.views, key)
-				s.FocusedViews.Pop()
-			}
-		}
-
 		s.FillQueryParamsPopup.SelectedParamIdx = 0
 
 		deleteInputReducer := l.store.AddReducer(func(s *state.State, a store.Action) {
@@ -300,34 +303,351 @@ reduceSwitch:
 			}).
 			Build()
 
-		s.FocusedViews.Push(popupName)
-		l.views[popupName] = &viewDescriptor{
-			view: aPopup,
-			getOffset: func() (dx, dy int) {
-				return 0, 0
-			},
-			getSize: func() (int, int) {
-				return l.screen.Size()
-			},
-			focused:    true,
-			focusOrder: -1,
-			externalKeyBindings: []*KeyBinding{
-				NewFuncKeyBinding("Next param", true, tcell.KeyDown, func(ev *tcell.EventKey, ctx KeyBindingContext) {
-					ctx.store.Dispatch(state.FillQueryParamsPopupNextField{})
-				}),
-				NewFuncKeyBinding("Prev param", true, tcell.KeyUp, func(ev *tcell.EventKey, ctx KeyBindingContext) {
-					ctx.store.Dispatch(state.FillQueryParamsPopupPrevField{})
-				}),
-				NewFuncKeyBinding("Delete", false, tcell.KeyDEL, func(ev *tcell.EventKey, ctx KeyBindingContext) {
-					ctx.store.Dispatch(state.InputBackspace{})
-				}),
-			},
+		s.InputMode = true
+
+		l.showPopup(s, aPopup, []*KeyBinding{
+			NewFuncKeyBinding("Next param", true, tcell.KeyDown, func(ev *tcell.EventKey, ctx KeyBindingContext) {
+				ctx.store.Dispatch(state.FillQueryParamsPopupNextField{})
+			}),
+			NewFuncKeyBinding("Prev param", true, tcell.KeyUp, func(ev *tcell.EventKey, ctx KeyBindingContext) {
+				ctx.store.Dispatch(state.FillQueryParamsPopupPrevField{})
+			}),
+			NewFuncKeyBinding("Delete", false, tcell.KeyDEL, func(ev *tcell.EventKey, ctx KeyBindingContext) {
+				ctx.store.Dispatch(state.InputBackspace{})
+			}),
+		})
+		//l.store.Dispatch(state.ForceRedraw{})
+	case state.ShowProfilesPopup:
+		const popupName = "profiles-popup"
+		if l.hidePopup(s, popupName) {
+			break
+		}
+
+		s.SelectProfilePopup.SelectedIdx = 0
+
+		aPopup := NewBuilder().
+			Name(popupName).
+			Title("Switch profile").
+			Style(tcell.StyleDefault.Background(tcell.ColorDarkBlue).Foreground(tcell.ColorWhite)).
+			Width(50).
+			Height(15).
+			ContentRenderer(SelectOptionRenderer(func(s *state.State) state.SelectQueryPopupData {
+				return s.SelectProfilePopup
+			})).
+			Control("Cancel", func() {
+				l.store.Dispatch(state.HidePopup{})
+			}).
+			Control("Switch", func() {
+				l.store.Dispatch(state.HidePopup{})
+				l.store.Dispatch(state.SwitchProfile{})
+			}).
+			Build()
+
+		l.showPopup(s, aPopup, []*KeyBinding{
+			NewFuncKeyBinding("Next option", true, tcell.KeyDown, func(ev *tcell.EventKey, ctx KeyBindingContext) {
+				ctx.store.Dispatch(state.ProfilesListNextOption{})
+			}),
+			NewFuncKeyBinding("Prev option", true, tcell.KeyUp, func(ev *tcell.EventKey, ctx KeyBindingContext) {
+				ctx.store.Dispatch(state.ProfilesListPrevOption{})
+			}),
+		})
+		l.store.Dispatch(state.ForceRedraw{})
+	case state.ShowQueuesPopup:
+		const popupName = "queues-popup"
+		if l.hidePopup(s, popupName) {
+			break
+		}
+
+		s.SelectQueuePopup.SelectedIdx = 0
+
+		aPopup := NewBuilder().
+			Name(popupName).
+			Title("Queues").
+			Style(tcell.StyleDefault.Background(tcell.ColorDarkBlue).Foreground(tcell.ColorWhite)).
+			Width(80).
+			Height(20).
+			ContentRenderer(SelectOptionRenderer(func(s *state.State) state.SelectQueryPopupData {
+				return s.SelectQueuePopup
+			})).
+			Control("Cancel", func() {
+				l.store.Dispatch(state.HidePopup{})
+			}).
+			Control("Use", func() {
+				l.store.Dispatch(state.HidePopup{})
+				l.store.Dispatch(state.UseSelectedQueue{})
+			}).
+			Build()
+
+		l.showPopup(s, aPopup, []*KeyBinding{
+			NewFuncKeyBinding("Next option", true, tcell.KeyDown, func(ev *tcell.EventKey, ctx KeyBindingContext) {
+				ctx.store.Dispatch(state.QueuesListNextOption{})
+			}),
+			NewFuncKeyBinding("Prev option", true, tcell.KeyUp, func(ev *tcell.EventKey, ctx KeyBindingContext) {
+				ctx.store.Dispatch(state.QueuesListPrevOption{})
+			}),
+		})
+		l.store.Dispatch(state.ForceRedraw{})
+	case state.ShowMoveToPopup:
+		const popupName = "move-to-popup"
+		if l.hidePopup(s, popupName) {
+			break
+		}
+
+		if s.SelectedMessageIdx < 0 {
+			break
+		}
+
+		s.MoveToPopup.SelectedIdx = 0
+
+		aPopup := NewBuilder().
+			Name(popupName).
+			Title("Move message to…").
+			Style(tcell.StyleDefault.Background(tcell.ColorDarkBlue).Foreground(tcell.ColorWhite)).
+			Width(50).
+			Height(15).
+			ContentRenderer(SelectOptionRenderer(func(s *state.State) state.SelectQueryPopupData {
+				return s.MoveToPopup
+			})).
+			Control("Cancel", func() {
+				l.store.Dispatch(state.HidePopup{})
+			}).
+			Control("Move", func() {
+				l.store.Dispatch(state.HidePopup{})
+				current := l.store.GetCurrent()
+				if !hasMarkedMessages(current) {
+					l.store.Dispatch(state.MoveMessage{MessageIdx: current.SelectedMessageIdx})
+					return
+				}
+				if destination, ok := current.MoveToPopup.Options[current.MoveToPopup.SelectedIdx].Value.(state.Destination); ok {
+					l.store.Dispatch(state.StartBulkOperation{Kind: state.BulkMove, Destination: destination})
+				}
+			}).
+			Build()
+
+		l.showPopup(s, aPopup, []*KeyBinding{
+			NewFuncKeyBinding("Next option", true, tcell.KeyDown, func(ev *tcell.EventKey, ctx KeyBindingContext) {
+				ctx.store.Dispatch(state.MoveToListNextOption{})
+			}),
+			NewFuncKeyBinding("Prev option", true, tcell.KeyUp, func(ev *tcell.EventKey, ctx KeyBindingContext) {
+				ctx.store.Dispatch(state.MoveToListPrevOption{})
+			}),
+		})
+		l.store.Dispatch(state.ForceRedraw{})
+	case state.ShowExportPopup:
+		const popupName = "export-popup"
+		if l.hidePopup(s, popupName) {
+			break
+		}
+
+		s.ExportPopup.SelectedIdx = 0
+
+		aPopup := NewBuilder().
+			Name(popupName).
+			Title("Export messages…").
+			Style(tcell.StyleDefault.Background(tcell.ColorDarkBlue).Foreground(tcell.ColorWhite)).
+			Width(50).
+			Height(10).
+			ContentRenderer(SelectOptionRenderer(func(s *state.State) state.SelectQueryPopupData {
+				return s.ExportPopup
+			})).
+			Control("Cancel", func() {
+				l.store.Dispatch(state.HidePopup{})
+			}).
+			Control("To dir", func() {
+				l.store.Dispatch(state.HidePopup{})
+				l.store.Dispatch(state.ExportMessages{Directory: true})
+			}).
+			Control("To JSONL", func() {
+				l.store.Dispatch(state.HidePopup{})
+				l.store.Dispatch(state.ExportMessages{})
+			}).
+			Build()
+
+		l.showPopup(s, aPopup, []*KeyBinding{
+			NewFuncKeyBinding("Next option", true, tcell.KeyDown, func(ev *tcell.EventKey, ctx KeyBindingContext) {
+				ctx.store.Dispatch(state.ExportListNextOption{})
+			}),
+			NewFuncKeyBinding("Prev option", true, tcell.KeyUp, func(ev *tcell.EventKey, ctx KeyBindingContext) {
+				ctx.store.Dispatch(state.ExportListPrevOption{})
+			}),
+		})
+		l.store.Dispatch(state.ForceRedraw{})
+	case state.ShowFilterPopup:
+		const popupName = "filter-popup"
+		if l.hidePopup(s, popupName) {
+			break
+		}
+
+		deleteInputReducer := l.store.AddReducer(func(s *state.State, a store.Action) {
+			switch action := a.(type) {
+			case state.Input:
+				l.store.Dispatch(state.FilterTextChanged{Text: s.Filter.Text + string(action.Ch)})
+			case state.InputBackspace:
+				if runes := []rune(s.Filter.Text); len(runes) > 0 {
+					l.store.Dispatch(state.FilterTextChanged{Text: string(runes[:len(runes)-1])})
+				}
+			}
+		})
+		aPopup := NewBuilder().
+			Name(popupName).
+			Title("Filter messages").
+			Style(tcell.StyleDefault.Background(tcell.ColorDarkBlue).Foreground(tcell.ColorWhite)).
+			Width(50).
+			Height(5).
+			ContentRenderer(InputRenderer("Contains:", func(s *state.State) string {
+				return s.Filter.Text
+			})).
+			Control("Clear", func() {
+				deleteInputReducer()
+				l.store.Dispatch(state.StopInputMode{})
+				l.store.Dispatch(state.HidePopup{})
+				l.store.Dispatch(state.ClearFilter{})
+			}).
+			Control("Apply", func() {
+				deleteInputReducer()
+				l.store.Dispatch(state.StopInputMode{})
+				l.store.Dispatch(state.HidePopup{})
+			}).
+			Build()
+
+		s.InputMode = true
+
+		l.showPopup(s, aPopup, []*KeyBinding{
+			NewFuncKeyBinding("Delete", false, tcell.KeyDEL, func(ev *tcell.EventKey, ctx KeyBindingContext) {
+				ctx.store.Dispatch(state.InputBackspace{})
+			}),
+		})
+	case state.ShowImportPopup:
+		const popupName = "import-popup"
+		if l.hidePopup(s, popupName) {
+			break
 		}
 
+		deleteInputReducer := l.store.AddReducer(func(s *state.State, a store.Action) {
+			switch action := a.(type) {
+			case state.Input:
+				s.ImportPath += string(action.Ch)
+			case state.InputBackspace:
+				if runes := []rune(s.ImportPath); len(runes) > 0 {
+					s.ImportPath = string(runes[:len(runes)-1])
+				}
+			}
+		})
+		aPopup := NewBuilder().
+			Name(popupName).
+			Title("Import messages").
+			Style(tcell.StyleDefault.Background(tcell.ColorDarkBlue).Foreground(tcell.ColorWhite)).
+			Width(60).
+			Height(5).
+			ContentRenderer(InputRenderer("JSONL file or directory:", func(s *state.State) string {
+				return s.ImportPath
+			})).
+			Control("Cancel", func() {
+				deleteInputReducer()
+				l.store.Dispatch(state.StopInputMode{})
+				l.store.Dispatch(state.HidePopup{})
+			}).
+			Control("Import", func() {
+				deleteInputReducer()
+				l.store.Dispatch(state.StopInputMode{})
+				l.store.Dispatch(state.HidePopup{})
+				l.store.Dispatch(state.ImportMessages{})
+			}).
+			Build()
+
 		s.InputMode = true
 
-		recalculateActions(s, l)
-		//l.store.Dispatch(state.ForceRedraw{})
+		l.showPopup(s, aPopup, []*KeyBinding{
+			NewFuncKeyBinding("Delete", false, tcell.KeyDEL, func(ev *tcell.EventKey, ctx KeyBindingContext) {
+				ctx.store.Dispatch(state.InputBackspace{})
+			}),
+		})
+	case state.ToggleShowGroups:
+		// Hidden groups view can't stay focused
+		if s.FocusedViews.Length() > 0 && s.FocusedViews.Top() == groupsViewName {
+			l.store.Dispatch(state.FocusView{ViewName: listViewName})
+		}
+	case state.ShowConfirmPopup:
+		const popupName = "confirm-popup"
+		l.hidePopup(s, popupName)
+
+		aPopup := NewBuilder().
+			Name(popupName).
+			Title("Confirm").
+			Style(tcell.StyleDefault.Background(tcell.ColorDarkRed).Foreground(tcell.ColorWhite)).
+			Width(60).
+			Height(6).
+			ContentRenderer(TextLinesRenderer(func(s *state.State) []string {
+				return []string{action.Text}
+			})).
+			Control("Cancel", func() {
+				l.store.Dispatch(state.HidePopup{})
+			}).
+			Control("Confirm", func() {
+				l.store.Dispatch(state.HidePopup{})
+				l.store.Dispatch(action.Confirmed)
+			}).
+			Build()
+
+		l.showPopup(s, aPopup, []*KeyBinding{})
+	case state.BulkOperationFinished:
+		const popupName = "bulk-summary-popup"
+		l.hidePopup(s, popupName)
+
+		aPopup := NewBuilder().
+			Name(popupName).
+			Title("Summary").
+			Style(tcell.StyleDefault.Background(tcell.ColorDarkBlue).Foreground(tcell.ColorWhite)).
+			Width(60).
+			Height(15).
+			ContentRenderer(TextLinesRenderer(getBulkSummary)).
+			Control("OK", func() {
+				l.store.Dispatch(state.HidePopup{})
+			}).
+			Build()
+
+		l.showPopup(s, aPopup, []*KeyBinding{})
+	case state.EditMessage:
+		if action.MessageIdx < 0 || action.MessageIdx >= len(s.Messages) {
+			break
+		}
+		if s.BulkOperation != nil && !s.BulkOperation.IsFinished() {
+			// Edit would be lost, as the operation processes messages, as they were, when it was started
+			s.Notification = &state.NotificationStruct{
+				Value: "Can't edit messages while a bulk operation is in progress",
+				At:    time.Now(),
+			}
+			break
+		}
+		if s.Messages[action.MessageIdx].Processing {
+			// Edit would be lost, as the message is published, as it was
+			s.Notification = &state.NotificationStruct{
+				Value: "Message is being processed, wait for the broker",
+				At:    time.Now(),
+			}
+			break
+		}
+
+		var edited state.MessageStruct
+		var editErr error
+		if err := l.suspend(func() {
+			edited, editErr = editor.Edit(s.Messages[action.MessageIdx])
+		}); err != nil {
+			log.Fatalf("Can't restore screen after editing, err: %s", err.Error())
+		}
+
+		if editErr != nil {
+			log.Printf("Message wasn't edited, %s", editErr.Error())
+			if !errors.Is(editErr, editor.ErrCancelled) {
+				s.Notification = &state.NotificationStruct{
+					Value: "Can't edit message: " + editErr.Error(),
+					At:    time.Now(),
+				}
+			}
+			break
+		}
+
+		l.store.Dispatch(state.MessageEdited{MessageIdx: action.MessageIdx, Message: edited})
 	case state.HidePopup:
 		l.screen.HideCursor()
 		for key, descriptor := range l.views {
@@ -343,6 +663,67 @@ reduceSwitch:
 	}
 }
 
+// hidePopup hides a popup with the given name, if it's showing. Returns true, if popup was hidden
+func (l *Layout) hidePopup(s *state.State, popupName string) bool {
+	if _, ok := l.views[popupName]; !ok {
+		return false
+	}
+
+	delete(l.views, popupName)
+	s.FocusedViews.Pop()
+	l.views[s.FocusedViews.Top()].focused = true
+	recalculateActions(s, l)
+	return true
+}
+
+// showPopup shows a popup on top of other views and focuses it. Another popup, if any, is hidden
+func (l *Layout) showPopup(s *state.State, aPopup *Popup, bindings []*KeyBinding) {
+	// Hide another popups, if any; Unfocus other views
+	for key, descriptor := range l.views {
+		descriptor.focused = false
+		if _, ok := descriptor.view.(*Popup); ok {
+			delete(l.views, key)
+			s.FocusedViews.Pop()
+		}
+	}
+
+	s.FocusedViews.Push(aPopup.GetName())
+	l.views[aPopup.GetName()] = &viewDescriptor{
+		view: aPopup,
+		getOffset: func() (dx, dy int) {
+			return 0, 0
+		},
+		getSize: func() (int, int) {
+			return l.screen.Size()
+		},
+		focused:             true,
+		focusOrder:          -1,
+		externalKeyBindings: bindings,
+	}
+
+	recalculateActions(s, l)
+}
+
+// suspend gives terminal away to run an external program, e.g. editor, and takes it back with a new screen
+func (l *Layout) suspend(run func()) error {
+	l.screen.Fini()
+
+	run()
+
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return err
+	}
+	if err = screen.Init(); err != nil {
+		return err
+	}
+
+	l.screen = screen
+	go pollScreenEvents(l.screenEvents, l.screen)
+	l.store.Dispatch(state.ForceRedraw{})
+	return nil
+}
+
 func recalculateActions(s *state.State, l *Layout) {
 	newAppActions := make([]string, 0)
 	focusedView := l.views[s.FocusedViews.Top()]
@@ -414,6 +795,7 @@ func (l *Layout) drawView(s state.State, view *viewDescriptor) {
 func (l *Layout) recalculateViews(s state.State) {
 	showSqlResults := s.DatabaseOutputs != nil
 	sWidth, sHeight := l.screen.Size()
+	columnHeight := sHeight - 3
 
 	if showSqlResults {
 		l.views[sqlResultsViewName] = &viewDescriptor{
@@ -455,12 +837,7 @@ func (l *Layout) recalculateViews(s state.State) {
 			},
 		}
 
-		l.views[listViewName].getSize = func() (w, h int) {
-			w = (sWidth - 3) / 3
-			h = ((sHeight - 4) / 3) * 2
-			return w, h
-		}
-
+		columnHeight = ((sHeight - 4) / 3) * 2
 		l.views[detailsViewName].getSize = func() (w, h int) {
 			w = sWidth - 3 - (sWidth-3)/3
 			h = ((sHeight - 4) / 3) * 2
@@ -468,18 +845,49 @@ func (l *Layout) recalculateViews(s state.State) {
 		}
 	} else {
 		delete(l.views, sqlResultsViewName)
-		l.views[listViewName].getSize = func() (w, h int) {
-			w = (sWidth - 3) / 3
-			h = sHeight - 3
-			return w, h
-		}
-
 		l.views[detailsViewName].getSize = func() (w, h int) {
 			w = sWidth - 3 - (sWidth-3)/3
 			h = sHeight - 3
 			return w, h
 		}
 	}
+
+	// Groups view takes the upper third of the list column
+	listWidth := (sWidth - 3) / 3
+	if s.ShowGroups {
+		groupsHeight := columnHeight / 3
+		if _, ok := l.views[groupsViewName]; !ok {
+			l.views[groupsViewName] = &viewDescriptor{
+				view: &MessageGroupsView{},
+				getOffset: func() (dx, dy int) {
+					return 1, 1
+				},
+				focusOrder: 0,
+				externalKeyBindings: []*KeyBinding{
+					NewFuncKeyBinding("Switch view", false, tcell.KeyTAB, func(e *tcell.EventKey, ctx KeyBindingContext) {
+						ctx.store.Dispatch(state.FocusNextView{})
+					}),
+				},
+			}
+		}
+		l.views[groupsViewName].getSize = func() (w, h int) {
+			return listWidth, groupsHeight
+		}
+		l.views[listViewName].getOffset = func() (dx, dy int) {
+			return 1, groupsHeight + 2
+		}
+		l.views[listViewName].getSize = func() (w, h int) {
+			return listWidth, columnHeight - groupsHeight - 1
+		}
+	} else {
+		delete(l.views, groupsViewName)
+		l.views[listViewName].getOffset = func() (dx, dy int) {
+			return 1, 1
+		}
+		l.views[listViewName].getSize = func() (w, h int) {
+			return listWidth, columnHeight
+		}
+	}
 }
 
 func New(store *store.Store[state.State], exit func()) (*Layout, error) {
@@ -492,22 +900,24 @@ func New(store *store.Store[state.State], exit func()) (*Layout, error) {
 		return nil, err
 	}
 
-	exitWrapper := func() {
-		screen.Fini()
+	l := &Layout{
+		store:        store,
+		screen:       screen,
+		screenEvents: make(chan tcell.Event, 10),
+	}
+
+	l.exit = func() {
+		l.screen.Fini()
 		exit()
 	}
 
-	bindings := getGlobalBindings(exitWrapper)
+	l.globalBindings = getGlobalBindings()
+	l.views = l.getDefaultViews()
 
-	return &Layout{
-		views:          getDefaultViews(screen),
-		store:          store,
-		screen:         screen,
-		globalBindings: bindings,
-	}, nil
+	return l, nil
 }
 
-func getDefaultViews(screen tcell.Screen) map[string]*viewDescriptor {
+func (l *Layout) getDefaultViews() map[string]*viewDescriptor {
 
 	return map[string]*viewDescriptor{
 		listViewName: {
@@ -516,7 +926,7 @@ func getDefaultViews(screen tcell.Screen) map[string]*viewDescriptor {
 				return 1, 1
 			},
 			getSize: func() (width, height int) {
-				sWidth, sHeight := screen.Size()
+				sWidth, sHeight := l.screen.Size()
 				return (sWidth - 3) / 3, sHeight - 3
 			},
 			focused:    true,
@@ -530,13 +940,13 @@ func getDefaultViews(screen tcell.Screen) map[string]*viewDescriptor {
 		detailsViewName: {
 			view: &MessageDetailsView{},
 			getOffset: func() (dx, dy int) {
-				sWidth, _ := screen.Size()
+				sWidth, _ := l.screen.Size()
 				dx = (sWidth-3)/3 + 2
 				dy = 1
 				return dx, dy
 			},
 			getSize: func() (w, h int) {
-				sWidth, sHeight := screen.Size()
+				sWidth, sHeight := l.screen.Size()
 				w, h = sWidth-3-((sWidth-3)/3), sHeight-3
 				return w, h
 			},
@@ -551,12 +961,12 @@ func getDefaultViews(screen tcell.Screen) map[string]*viewDescriptor {
 		controlsViewName: {
 			view: &ControlsView{},
 			getOffset: func() (dx, dy int) {
-				_, sHeight := screen.Size()
+				_, sHeight := l.screen.Size()
 				dx, dy = 0, sHeight-1
 				return dx, dy
 			},
 			getSize: func() (w, h int) {
-				sWidth, _ := screen.Size()
+				sWidth, _ := l.screen.Size()
 				w, h = sWidth, 1
 				return
 			},
@@ -566,12 +976,12 @@ func getDefaultViews(screen tcell.Screen) map[string]*viewDescriptor {
 	}
 }
 
-func getGlobalBindings(exit func()) []*KeyBinding {
+func getGlobalBindings() []*KeyBinding {
 	return []*KeyBinding{
-		NewRuneKeyBinding("Exit", false, 'Q', exitHandler(exit)),
-		NewRuneKeyBinding("Exit", true, 'q', exitHandler(exit)),
-		NewFuncKeyBinding("Exit", true, tcell.KeyESC, exitHandler(exit)),
-		NewFuncKeyBinding("Exit", true, tcell.KeyCtrlC, exitHandler(exit)),
+		NewRuneKeyBinding("Exit", false, 'Q', exitHandler),
+		NewRuneKeyBinding("Exit", true, 'q', exitHandler),
+		NewFuncKeyBinding("Exit", true, tcell.KeyESC, exitHandler),
+		NewFuncKeyBinding("Exit", true, tcell.KeyCtrlC, exitHandler),
 		NewRuneKeyBinding("Show Headers", false, 'H', func(e *tcell.EventKey, ctx KeyBindingContext) {
 			ctx.store.Dispatch(state.ToggleShowHeaders{})
 		}),
@@ -584,15 +994,29 @@ func getGlobalBindings(exit func()) []*KeyBinding {
 		NewRuneKeyBinding("SQL", true, 's', func(ev *tcell.EventKey, ctx KeyBindingContext) {
 			ctx.store.Dispatch(state.ShowQueriesListPopup{})
 		}),
+		NewRuneKeyBinding("Groups", false, 'G', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.ToggleShowGroups{})
+		}),
+		NewRuneKeyBinding("Groups", true, 'g', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.ToggleShowGroups{})
+		}),
+		NewRuneKeyBinding("Queues", false, 'F', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.DiscoverQueues{})
+		}),
+		NewRuneKeyBinding("Queues", true, 'f', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.DiscoverQueues{})
+		}),
+		NewRuneKeyBinding("Profiles", false, 'P', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.ShowProfilesPopup{})
+		}),
+		NewRuneKeyBinding("Profiles", true, 'p', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.ShowProfilesPopup{})
+		}),
 	}
 }
 
-func exitHandler(exit func()) func(ev *tcell.EventKey, ctx KeyBindingContext) {
-	return func(_ *tcell.EventKey, ctx KeyBindingContext) {
-		messages := ctx.store.GetCurrent().Messages
-		if len(messages) > 0 {
-			ctx.store.Dispatch(state.RequeueMessages{})
-		}
-		exit()
-	}
+func exitHandler(_ *tcell.EventKey, ctx KeyBindingContext) {
+	ctx.store.Dispatch(state.CancelLoading{})
+	ctx.store.Dispatch(state.CancelBulkOperation{})
+	ctx.store.Dispatch(state.Exit{})
 }
@@ -1,9 +1,9 @@
 package layout
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
+	"math"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
@@ -12,12 +12,20 @@ import (
 
 	"DeadRabbit/commons"
 	"DeadRabbit/state"
+	"DeadRabbit/viewers"
 )
 
 const (
 	messageLineContinuationPrefix = "  "
 )
 
+var (
+	defaultDetailsStyle = tcell.StyleDefault.Foreground(tcell.ColorWhite).Background(tcell.ColorDefault)
+	errorStyle          = tcell.StyleDefault.Foreground(tcell.ColorRed).Background(tcell.ColorDefault)
+	addedStyle          = tcell.StyleDefault.Foreground(tcell.ColorGreen).Background(tcell.ColorDefault)
+	removedStyle        = tcell.StyleDefault.Foreground(tcell.ColorRed).Background(tcell.ColorDefault)
+)
+
 type MessageDetailsView struct {
 	ScrollableView
 }
@@ -28,36 +36,118 @@ func (m *MessageDetailsView) Draw(c DrawingContext) error {
 		return nil
 	}
 	width, _ := c.GetSize()
-	lines := make([]string, 0)
+	lines := make([]ScrollableViewLine, 0)
+	appendLines := func(style tcell.Style, texts ...string) {
+		for _, text := range texts {
+			lines = append(lines, ScrollableViewLine{Text: text, Style: style})
+		}
+	}
 
 	message := s.Messages[s.SelectedMessageIdx]
 
+	if message.Error != "" {
+		appendLines(errorStyle, commons.SplitByLength("Error: "+message.Error, width, messageLineContinuationPrefix)...)
+	}
+
 	if s.ShowHeaders {
-		lines = append(lines, m.parseHeaders(message, width)...)
+		appendLines(defaultDetailsStyle, "Properties:")
+		appendLines(defaultDetailsStyle, m.parseProperties(message, width)...)
+		appendLines(defaultDetailsStyle, "Headers:")
+		appendLines(defaultDetailsStyle, m.parseHeaders(message, width)...)
 	}
 
-	selectedMessageStr, err := prettifyJson(message.Body)
+	if message.Original != nil {
+		appendLines(defaultDetailsStyle, "Changes:")
+		for _, diffLine := range m.diff(*message.Original, message) {
+			switch diffLine.Kind {
+			case commons.Added:
+				appendLines(addedStyle, commons.SplitByLength("+ "+diffLine.Text, width, messageLineContinuationPrefix)...)
+			case commons.Removed:
+				appendLines(removedStyle, commons.SplitByLength("- "+diffLine.Text, width, messageLineContinuationPrefix)...)
+			}
+		}
+	}
+
+	viewerName, selectedMessageStr, err := viewers.View(message, s.BodyViewer)
 	if err != nil {
-		selectedMessageStr = "Can't parse message; err: " + err.Error()
+		// Body is still shown, even if it can't be parsed
+		appendLines(errorStyle, commons.SplitByLength(
+			fmt.Sprintf("Can't view message as %s; err: %s", viewerName, err.Error()), width, messageLineContinuationPrefix)...)
+		selectedMessageStr, _ = viewers.Fallback(message).View(message)
 	}
 	msgLines := strings.Split(selectedMessageStr, "\n")
 
 	format := fmt.Sprintf("%%%dd: %%s\n", len(strconv.Itoa(len(lines))))
 	for i, msgLine := range msgLines {
 		msgLine = fmt.Sprintf(format, i, msgLine)
-		lines = append(lines, commons.SplitByLength(msgLine, width, messageLineContinuationPrefix)...)
+		appendLines(defaultDetailsStyle, commons.SplitByLength(msgLine, width, messageLineContinuationPrefix)...)
 	}
 
-	m.drawContent(commons.MapTo(lines, func(_ int, text string) ScrollableViewLine {
-		return ScrollableViewLine{
-			Text:  text,
-			Style: tcell.StyleDefault.Foreground(tcell.ColorWhite).Background(tcell.ColorDefault),
-		}
-	}), c)
+	m.drawContent(lines, c)
 
 	return nil
 }
 
+// diff compares headers and bodies of original and edited messages
+func (m *MessageDetailsView) diff(original, edited state.MessageStruct) []commons.DiffLine {
+	toLines := func(message state.MessageStruct) []string {
+		lines := m.parseHeaders(message, math.MaxInt)
+		_, body, err := viewers.View(message, "")
+		if err != nil {
+			body, _ = viewers.Fallback(message).View(message)
+		}
+		return append(lines, strings.Split(body, "\n")...)
+	}
+
+	return commons.DiffLines(toLines(original), toLines(edited))
+}
+
+func (m *MessageDetailsView) parseProperties(message state.MessageStruct, width int) []string {
+	p := message.Properties
+	properties := []commons.Pair[string, any]{
+		{First: "replay to", Second: message.Destination.String()},
+		{First: "content-type", Second: p.ContentType},
+		{First: "content-encoding", Second: p.ContentEncoding},
+		{First: "compressed", Second: getCompressionDescription(message)},
+		{First: "delivery-mode", Second: p.DeliveryMode},
+		{First: "priority", Second: p.Priority},
+		{First: "correlation-id", Second: p.CorrelationId},
+		{First: "reply-to", Second: p.ReplyTo},
+		{First: "expiration", Second: p.Expiration},
+		{First: "message-id", Second: p.MessageId},
+		{First: "timestamp", Second: p.Timestamp},
+		{First: "type", Second: p.Type},
+		{First: "user-id", Second: p.UserId},
+		{First: "app-id", Second: p.AppId},
+		{First: "key", Second: p.Key},
+	}
+
+	const longestPropertyNameLength = len("content-encoding")
+	format := fmt.Sprintf("%%%ds: %%v", longestPropertyNameLength)
+
+	propertiesLines := make([]string, 0, len(properties))
+	for _, property := range properties {
+		if reflect.ValueOf(property.Second).IsZero() {
+			continue
+		}
+		propertyLine := fmt.Sprintf(format, property.First, property.Second)
+		propertiesLines = append(propertiesLines,
+			commons.SplitByLength(propertyLine, width, strings.Repeat(" ", longestPropertyNameLength+2))...)
+	}
+
+	return propertiesLines
+}
+
+func getCompressionDescription(message state.MessageStruct) string {
+	if message.Compression == "" {
+		return ""
+	}
+	if message.CompressedBody == "" {
+		return fmt.Sprintf("%s, body is shown decompressed and will be compressed again", message.Compression)
+	}
+	return fmt.Sprintf("%s, %d bytes; body is shown decompressed", message.Compression, len(message.CompressedBody))
+}
+
 func (m *MessageDetailsView) parseHeaders(message state.MessageStruct, width int) []string {
 	headersLines := make([]string, 0, len(message.Headers))
 	longestHeaderKeyLength := 0
@@ -84,6 +174,17 @@ func (m *MessageDetailsView) parseHeaders(message state.MessageStruct, width int
 	return headersLines
 }
 
+// getMessageDetailsTitleSuffix tells, which viewer the body is shown with
+func getMessageDetailsTitleSuffix(s state.State) string {
+	if s.SelectedMessageIdx < 0 || s.SelectedMessageIdx >= len(s.Messages) {
+		return ""
+	}
+	if s.BodyViewer == "" {
+		return fmt.Sprintf(" | %s (auto)", viewers.Detect(s.Messages[s.SelectedMessageIdx]).Name())
+	}
+	return " | " + s.BodyViewer
+}
+
 func (m *MessageDetailsView) GetName() string {
 	return "message-details"
 }
@@ -98,13 +199,17 @@ func (m *MessageDetailsView) GetKeyBindings() []*KeyBinding {
 			m.scrollUp()
 			ctx.store.Dispatch(state.ForceRedraw{})
 		}),
+		NewRuneKeyBinding("Viewer", false, 'V', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.NextBodyViewer{})
+		}),
+		NewRuneKeyBinding("Viewer", true, 'v', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.NextBodyViewer{})
+		}),
+		NewRuneKeyBinding("Edit", false, 'E', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.EditMessage{MessageIdx: ctx.store.GetCurrent().SelectedMessageIdx})
+		}),
+		NewRuneKeyBinding("Edit", true, 'e', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.EditMessage{MessageIdx: ctx.store.GetCurrent().SelectedMessageIdx})
+		}),
 	}
 }
-
-func prettifyJson(str string) (string, error) {
-	var prettyJSON bytes.Buffer
-	if err := json.Indent(&prettyJSON, []byte(str), "", "    "); err != nil {
-		return "", err
-	}
-	return prettyJSON.String(), nil
-}
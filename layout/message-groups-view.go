@@ -0,0 +1,72 @@
+package layout
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell"
+
+	"DeadRabbit/commons"
+	"DeadRabbit/state"
+)
+
+// MessageGroupsView shows how many messages are there per value of a grouping key, e.g. per failure reason
+type MessageGroupsView struct {
+	ScrollableView
+}
+
+func (m *MessageGroupsView) Draw(c DrawingContext) error {
+	defaultStyle := tcell.StyleDefault.Background(tcell.ColorDefault).Foreground(tcell.ColorWhite)
+	selectedStyle := tcell.StyleDefault.Background(tcell.ColorWhite).Foreground(tcell.ColorBlack)
+	filteredStyle := tcell.StyleDefault.Background(tcell.ColorDefault).Foreground(tcell.ColorGreen)
+
+	s := c.GetState()
+	maxX, _ := c.GetSize()
+	key := s.GroupKey()
+
+	lines := commons.MapTo(s.MessageGroups(), func(i int, group state.MessageGroup) ScrollableViewLine {
+		style := defaultStyle
+		if i == s.SelectedGroupIdx {
+			style = selectedStyle
+		} else if f := s.Filter.Group; f != nil && f.Key == key && f.Value == group.Value {
+			style = filteredStyle
+		}
+
+		text := []rune(fmt.Sprintf("%6s %s", formatThousands(group.Count), group.Value))
+		if len(text) > maxX {
+			text = append(text[:maxX-1], '…')
+		}
+		return ScrollableViewLine{Text: string(text), Style: style}
+	})
+
+	m.drawContentKeepingVisible(lines, s.SelectedGroupIdx, c)
+	return nil
+}
+
+// getMessageGroupsTitleSuffix tells, which key messages are grouped by
+func getMessageGroupsTitleSuffix(s state.State) string {
+	return " by " + s.GroupKey()
+}
+
+func (m *MessageGroupsView) GetName() string {
+	return "message-groups"
+}
+
+func (m *MessageGroupsView) GetKeyBindings() []*KeyBinding {
+	return []*KeyBinding{
+		NewFuncKeyBinding("Next group", true, tcell.KeyDown, func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.NextGroup{})
+		}),
+		NewFuncKeyBinding("Prev group", true, tcell.KeyUp, func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.PrevGroup{})
+		}),
+		NewFuncKeyBinding("Filter by group", false, tcell.KeyEnter, func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.FilterBySelectedGroup{})
+		}),
+		NewRuneKeyBinding("Next key", false, 'K', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.NextGroupKey{})
+		}),
+		NewRuneKeyBinding("Next key", true, 'k', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.NextGroupKey{})
+		}),
+	}
+}
@@ -3,6 +3,7 @@ package layout
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/gdamore/tcell"
 
@@ -17,21 +18,51 @@ type MessageListView struct {
 func (m *MessageListView) Draw(c DrawingContext) error {
 	defaultStyle := tcell.StyleDefault.Background(tcell.ColorDefault).Foreground(tcell.ColorWhite)
 	selectedStyle := tcell.StyleDefault.Background(tcell.ColorWhite).Foreground(tcell.ColorBlack)
+	failedStyle := tcell.StyleDefault.Background(tcell.ColorDefault).Foreground(tcell.ColorRed)
+	failedSelectedStyle := tcell.StyleDefault.Background(tcell.ColorWhite).Foreground(tcell.ColorRed)
 
 	s := c.GetState()
 	maxX, _ := c.GetSize()
 
-	scrollableLines := commons.MapTo(s.Messages, func(i int, message state.MessageStruct) ScrollableViewLine {
+	visibleIdx := s.VisibleMessagesIdx()
+	selectedLineIdx := -1
+
+	scrollableLines := commons.MapTo(visibleIdx, func(lineIdx int, i int) ScrollableViewLine {
+		message := s.Messages[i]
 		style := defaultStyle
-		if i == s.SelectedMessageIdx {
+		if i == s.SelectedMessageIdx && message.Error != "" {
+			style = failedSelectedStyle
+		} else if i == s.SelectedMessageIdx {
 			style = selectedStyle
+		} else if message.Error != "" {
+			style = failedStyle
+		}
+		if i == s.SelectedMessageIdx {
+			selectedLineIdx = lineIdx
 		}
 
 		maxMsgLen := maxX - 1
-		msgText := fmt.Sprintf("%s. %s", strconv.Itoa(i), message.Body)
+		marks := ""
+		if message.Selected {
+			marks += "●"
+		}
+		if message.Original != nil {
+			marks += "*"
+		}
+		if message.ReplayCount > 0 {
+			marks += fmt.Sprintf("↻%d", message.ReplayCount)
+		}
+		if message.Imported {
+			marks += "⇣"
+		}
+		if message.Processing {
+			marks += "…"
+		}
+		msgText := fmt.Sprintf("%s.%s →%s %s", strconv.Itoa(i), marks, message.Destination, message.Body)
 
-		if len(msgText) > maxMsgLen {
-			msgText = fmt.Sprintf("%s%s", msgText[0:maxMsgLen-1], "…")
+		msgRunes := []rune(msgText)
+		if len(msgRunes) > maxMsgLen {
+			msgText = fmt.Sprintf("%s%s", string(msgRunes[0:maxMsgLen-1]), "…")
 		}
 
 		return ScrollableViewLine{
@@ -40,46 +71,188 @@ func (m *MessageListView) Draw(c DrawingContext) error {
 		}
 	})
 
-	m.drawContent(scrollableLines, c)
+	m.drawContentKeepingVisible(scrollableLines, selectedLineIdx, c)
 	return nil
 }
 
+// getMessageListTitleSuffix tells, which part of the DLQ is loaded, e.g. "1–200 of 48 312"
+func getMessageListTitleSuffix(s state.State) string {
+	total := len(s.Messages) + s.QueueDepth
+	suffix := fmt.Sprintf(" %s of %s", formatRange(len(s.Messages)), formatThousands(total))
+	if s.LoadingMessages {
+		suffix += " (loading…)"
+	}
+	if !s.Filter.IsEmpty() {
+		suffix += fmt.Sprintf(" | filter: %s (%d)", s.Filter, len(s.VisibleMessagesIdx()))
+	}
+	if selected := len(s.MarkedMessages()); selected > 0 {
+		suffix += fmt.Sprintf(" | %d marked", selected)
+	}
+	if b := s.BulkOperation; b != nil && !b.IsFinished() {
+		suffix += fmt.Sprintf(" | %s %s %d/%d", b.Kind, formatProgressBar(len(b.Results), b.Total), len(b.Results), b.Total)
+		if b.Paused {
+			suffix += " (paused)"
+		}
+	}
+	return suffix
+}
+
+// formatProgressBar draws a fixed width bar, e.g. "[████░░░░░░]"
+func formatProgressBar(done, total int) string {
+	const width = 10
+	filled := width
+	if total > 0 {
+		filled = done * width / total
+	}
+	return "[" + strings.Repeat("█", filled) + strings.Repeat("░", width-filled) + "]"
+}
+
+func formatRange(loaded int) string {
+	if loaded == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("1–%s", formatThousands(loaded))
+}
+
+// formatThousands formats a number with groups of thousands separated by spaces
+func formatThousands(n int) string {
+	digits := strconv.Itoa(n)
+	result := strings.Builder{}
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			result.WriteRune(' ')
+		}
+		result.WriteRune(d)
+	}
+	return result.String()
+}
+
 func (m *MessageListView) GetName() string {
 	return "message-list"
 }
 
 func (m *MessageListView) GetKeyBindings() []*KeyBinding {
 	return []*KeyBinding{
+		NewModFuncKeyBinding("Mark down", true, tcell.ModShift, tcell.KeyDown, func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.SelectRange{Direction: 1})
+		}),
+		NewModFuncKeyBinding("Mark up", true, tcell.ModShift, tcell.KeyUp, func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.SelectRange{Direction: -1})
+		}),
 		NewFuncKeyBinding("Next msg", false, tcell.KeyDown, func(ev *tcell.EventKey, ctx KeyBindingContext) {
-			aState := ctx.store.GetCurrent()
-			if aState.SelectedMessageIdx-m.from >= ctx.viewHeight-1 && aState.SelectedMessageIdx < len(aState.Messages)-1 {
-				m.scrollDown()
-			}
 			ctx.store.Dispatch(state.NextMessage{})
 		}),
 		NewFuncKeyBinding("Prev msg", false, tcell.KeyUp, func(ev *tcell.EventKey, ctx KeyBindingContext) {
-			if ctx.store.GetCurrent().SelectedMessageIdx <= m.from {
-				m.scrollUp()
-			}
 			ctx.store.Dispatch(state.PrevMessage{})
 		}),
-		NewRuneKeyBinding("Load", false, 'L', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+		NewRuneKeyBinding("Mark", false, ' ', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.ToggleMessageSelection{MessageIdx: ctx.store.GetCurrent().SelectedMessageIdx})
+		}),
+		NewRuneKeyBinding("Mark all", false, 'A', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.ToggleSelectAllVisible{})
+		}),
+		NewRuneKeyBinding("Mark all", true, 'a', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.ToggleSelectAllVisible{})
+		}),
+		NewRuneKeyBinding("Filter", false, '/', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.ShowFilterPopup{})
+		}),
+		NewRuneKeyBinding("Load page", false, 'L', func(ev *tcell.EventKey, ctx KeyBindingContext) {
 			ctx.store.Dispatch(state.LoadMessages{})
 		}),
-		NewRuneKeyBinding("Load", true, 'l', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+		NewRuneKeyBinding("Load page", true, 'l', func(ev *tcell.EventKey, ctx KeyBindingContext) {
 			ctx.store.Dispatch(state.LoadMessages{})
 		}),
-		NewRuneKeyBinding("Drop", true, 'd', func(ev *tcell.EventKey, ctx KeyBindingContext) {
-			ctx.store.Dispatch(state.DropMessage{MessageIdx: ctx.store.GetCurrent().SelectedMessageIdx})
+		NewRuneKeyBinding("Cancel load", false, 'C', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.CancelLoading{})
+		}),
+		NewRuneKeyBinding("Cancel load", true, 'c', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.CancelLoading{})
+		}),
+		NewRuneKeyBinding("Release all", false, 'U', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.ReleaseMessages{})
+		}),
+		NewRuneKeyBinding("Release all", true, 'u', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.ReleaseMessages{})
+		}),
+		NewRuneKeyBinding("Drop", true, 'd', dropHandler),
+		NewRuneKeyBinding("Drop", false, 'D', dropHandler),
+		NewRuneKeyBinding("Move to", true, 'm', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.ShowMoveToPopup{})
+		}),
+		NewRuneKeyBinding("Move to", false, 'M', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.ShowMoveToPopup{})
+		}),
+		NewRuneKeyBinding("Export", true, 'w', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.ShowExportPopup{})
 		}),
-		NewRuneKeyBinding("Drop", false, 'D', func(ev *tcell.EventKey, ctx KeyBindingContext) {
-			ctx.store.Dispatch(state.DropMessage{MessageIdx: ctx.store.GetCurrent().SelectedMessageIdx})
+		NewRuneKeyBinding("Export", false, 'W', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.ShowExportPopup{})
 		}),
-		NewRuneKeyBinding("Requeue", true, 'r', func(ev *tcell.EventKey, ctx KeyBindingContext) {
-			ctx.store.Dispatch(state.RequeueMessage{MessageIdx: ctx.store.GetCurrent().SelectedMessageIdx})
+		NewRuneKeyBinding("Import", true, 'i', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.ShowImportPopup{})
 		}),
-		NewRuneKeyBinding("Requeue", false, 'R', func(ev *tcell.EventKey, ctx KeyBindingContext) {
-			ctx.store.Dispatch(state.RequeueMessage{MessageIdx: ctx.store.GetCurrent().SelectedMessageIdx})
+		NewRuneKeyBinding("Import", false, 'I', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.ShowImportPopup{})
 		}),
+		NewRuneKeyBinding("Pause/resume bulk", true, 'z', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.PauseBulkOperation{})
+		}),
+		NewRuneKeyBinding("Pause/resume bulk", false, 'Z', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.PauseBulkOperation{})
+		}),
+		NewRuneKeyBinding("Stop bulk", true, 'x', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.CancelBulkOperation{})
+		}),
+		NewRuneKeyBinding("Stop bulk", false, 'X', func(ev *tcell.EventKey, ctx KeyBindingContext) {
+			ctx.store.Dispatch(state.CancelBulkOperation{})
+		}),
+		NewRuneKeyBinding("Requeue", true, 'r', requeueHandler),
+		NewRuneKeyBinding("Requeue", false, 'R', requeueHandler),
+	}
+}
+
+// hasMarkedMessages tells, whether an action should be applied to marked messages, instead of a current one
+func hasMarkedMessages(s state.State) bool {
+	return len(s.MarkedMessages()) > 0
+}
+
+func dropHandler(_ *tcell.EventKey, ctx KeyBindingContext) {
+	if hasMarkedMessages(ctx.store.GetCurrent()) {
+		ctx.store.Dispatch(state.StartBulkOperation{Kind: state.BulkDrop})
+		return
+	}
+	ctx.store.Dispatch(state.DropMessage{MessageIdx: ctx.store.GetCurrent().SelectedMessageIdx})
+}
+
+func requeueHandler(_ *tcell.EventKey, ctx KeyBindingContext) {
+	if hasMarkedMessages(ctx.store.GetCurrent()) {
+		ctx.store.Dispatch(state.StartBulkOperation{Kind: state.BulkRequeue})
+		return
+	}
+	ctx.store.Dispatch(state.RequeueMessage{MessageIdx: ctx.store.GetCurrent().SelectedMessageIdx})
+}
+
+func getBulkSummary(s *state.State) []string {
+	b := s.BulkOperation
+	if b == nil {
+		return []string{}
+	}
+
+	lines := []string{
+		fmt.Sprintf("%s: %d of %d succeeded, %d failed", b.Kind, len(b.Results)-b.Failed(), b.Total, b.Failed()),
+	}
+	if s.DryRun {
+		lines[0] = "DRY RUN " + lines[0] + "; nothing was sent"
+	}
+	for _, result := range b.Results {
+		if result.Error == nil {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("#%d: %s", s.FindMessage(result.MessageId), result.Error.Error()))
+	}
+	if len(b.Results) < b.Total {
+		lines = append(lines, fmt.Sprintf("%d messages weren't processed", b.Total-len(b.Results)))
 	}
+	return lines
 }
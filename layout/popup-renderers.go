@@ -7,6 +7,7 @@ import (
 	"github.com/gdamore/tcell"
 
 	"DeadRabbit/commons"
+	"DeadRabbit/state"
 )
 
 func CroppingTextRenderer(text string) PopupRendererFunc {
@@ -80,8 +81,15 @@ func FillQueryParamsRenderer() PopupRendererFunc {
 }
 
 func SelectQueryRenderer() PopupRendererFunc {
+	return SelectOptionRenderer(func(s *state.State) state.SelectQueryPopupData {
+		return s.SelectQueryPopup
+	})
+}
+
+// SelectOptionRenderer draws a text, followed by a list of options, one of which is selected
+func SelectOptionRenderer(getData func(s *state.State) state.SelectQueryPopupData) PopupRendererFunc {
 	return func(width, height, x, y int, ctx DrawingContext, style tcell.Style) {
-		data := ctx.GetState().SelectQueryPopup
+		data := getData(ctx.GetState())
 		text := data.Text
 		options := data.Options
 		textLines := commons.SplitByLength(text, width, "")
@@ -127,3 +135,42 @@ func SelectQueryRenderer() PopupRendererFunc {
 
 	}
 }
+
+// InputRenderer draws a single input field with a label
+func InputRenderer(label string, getValue func(s *state.State) string) PopupRendererFunc {
+	inputStyle := tcell.StyleDefault.Background(tcell.ColorWhite).Foreground(tcell.ColorBlack)
+	return func(width, height, x, y int, ctx DrawingContext, style tcell.Style) {
+		labelRunes := []rune(label + " ")
+		valueRunes := []rune(getValue(ctx.GetState()))
+
+		for dx := 0; dx < width; dx++ {
+			if dx < len(labelRunes) {
+				ctx.SetCell(x+dx, y, style, labelRunes[dx])
+			} else if dx-len(labelRunes) < len(valueRunes) {
+				ctx.SetCell(x+dx, y, inputStyle, valueRunes[dx-len(labelRunes)])
+			} else {
+				ctx.SetCell(x+dx, y, inputStyle, ' ')
+			}
+		}
+
+		ctx.SetCursor(x+len(labelRunes)+len(valueRunes), y)
+	}
+}
+
+// TextLinesRenderer draws lines of text, wrapping long ones and cropping ones, which don't fit
+func TextLinesRenderer(getLines func(s *state.State) []string) PopupRendererFunc {
+	return func(width, height, x, y int, ctx DrawingContext, style tcell.Style) {
+		dy := 0
+		for _, line := range getLines(ctx.GetState()) {
+			for _, wrapped := range commons.SplitByLength(line, width, "  ") {
+				if dy >= height {
+					return
+				}
+				for dx, r := range []rune(wrapped) {
+					ctx.SetCell(x+dx, y+dy, style, r)
+				}
+				dy++
+			}
+		}
+	}
+}
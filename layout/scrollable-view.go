@@ -29,6 +29,26 @@ type ScrollableViewLine struct {
 
 func (view *ScrollableView) drawContent(content []ScrollableViewLine, c DrawingContext) {
 	view.checkContent(content)
+	view.drawLines(content, c)
+}
+
+// drawContentKeepingVisible draws content, scrolling it just enough to keep the given line visible
+func (view *ScrollableView) drawContentKeepingVisible(content []ScrollableViewLine, visibleLineIdx int, c DrawingContext) {
+	_, viewHeight := c.GetSize()
+	if visibleLineIdx >= 0 {
+		if visibleLineIdx < view.from {
+			view.from = visibleLineIdx
+		} else if visibleLineIdx >= view.from+viewHeight {
+			view.from = visibleLineIdx - viewHeight + 1
+		}
+	}
+	if view.from > 0 && view.from >= len(content) {
+		view.from = 0
+	}
+	view.drawLines(content, c)
+}
+
+func (view *ScrollableView) drawLines(content []ScrollableViewLine, c DrawingContext) {
 	view.contentHeight = len(content)
 
 	_, viewHeight := c.GetSize()
@@ -1,32 +1,130 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"gopkg.in/yaml.v2"
 
+	"DeadRabbit/codecs"
 	"DeadRabbit/commons"
+	"DeadRabbit/journal"
+	"DeadRabbit/kafka"
 	"DeadRabbit/layout"
+	"DeadRabbit/management"
+	"DeadRabbit/memory"
 	"DeadRabbit/mysql"
 	"DeadRabbit/rabbitmq"
+	"DeadRabbit/replay"
 	"DeadRabbit/state"
 	"DeadRabbit/store"
 )
 
-const configPath = "configuration.yaml"
+const (
+	configPath          = "configuration.yaml"
+	defaultDryRunReport = "dry-run-report.jsonl"
+	defaultJournal      = "journal.jsonl"
+	defaultExport       = "exports"
+)
 
 var (
 	aConfiguration configuration
-	aStore         *store.Store[state.State]
-	aLayout        *layout.Layout
+	// lastMessageId is shared by sessions, so ids are unique across profiles
+	lastMessageId uint64
+)
+
+const (
+	rabbitmqBroker = "rabbitmq"
+	kafkaBroker    = "kafka"
+	// memoryBroker imitates RabbitMQ in memory; it's configured with the same keys and seeded from a fixture
+	memoryBroker = "memory"
 )
 
+type profile struct {
+	Name string
+	// Broker is one of rabbitmqBroker (default), kafkaBroker or memoryBroker
+	Broker     string
+	Rabbitmq   rabbitmq.Configuration `yaml:",inline"`
+	Management management.Configuration
+	Kafka      kafka.Configuration
+	Memory     memory.Configuration
+}
+
+func (p profile) isKafka() bool {
+	return p.Broker == kafkaBroker
+}
+
+func (p profile) isMemory() bool {
+	return p.Broker == memoryBroker
+}
+
+// dlq is a name of a dead-letter queue or topic of the profile
+func (p profile) dlq() string {
+	if p.isKafka() {
+		return p.Kafka.Topic
+	}
+	return p.Rabbitmq.Dlq
+}
+
+func (p profile) alertsOnNewMessages() bool {
+	if p.isKafka() {
+		return p.Kafka.Monitor.Alert
+	}
+	return p.Rabbitmq.Monitor.Alert
+}
+
+func (p profile) setDryRun(dryRun bool) profile {
+	p.Rabbitmq.DryRun = dryRun
+	p.Kafka.DryRun = dryRun
+	return p
+}
+
+// fixture is a fixture of an in-memory broker to show
+func (p profile) fixture() string {
+	if p.Memory.Fixture == "" {
+		return "built-in demo"
+	}
+	return p.Memory.Fixture
+}
+
+// managementConfiguration defaults management API credentials to RabbitMQ ones
+func (p profile) managementConfiguration() management.Configuration {
+	c := p.Management
+	if c.User == "" {
+		c.User = p.Rabbitmq.User
+		c.Password = p.Rabbitmq.Password
+	}
+	return c
+}
+
 type configuration struct {
-	Rabbitmq  rabbitmq.Configuration
-	Debug     bool
+	Broker     string
+	Rabbitmq   rabbitmq.Configuration
+	Management management.Configuration
+	Kafka      kafka.Configuration
+	Memory     memory.Configuration
+	Replay     replay.Configuration
+	Profiles   []profile
+	Debug      bool
+	// DryRun doesn't send any mutating operation to brokers; could be also enabled with --dry-run flag
+	DryRun bool `yaml:"dryRun"`
+	// Schemas are used to decode binary message bodies
+	Schemas codecs.Configuration
+	// GroupBy are keys, messages could be grouped by in the groups view
+	GroupBy []string `yaml:"groupBy"`
+	// Journal is a file, taken messages and actions, applied to them, are recorded to
+	Journal string
+	// DryRunReport is a file, skipped operations are written to on exit
+	DryRunReport string `yaml:"dryRunReport"`
+	// Export is a directory, messages are exported to
+	Export    string
 	Databases []struct {
 		Host     string
 		Port     string
@@ -46,11 +144,40 @@ type configuration struct {
 }
 
 func main() {
+	dryRun := flag.Bool("dry-run", false, "Log mutating operations instead of sending them to the broker")
+	demo := flag.Bool("demo", false, "Use an in-memory broker, seeded from a fixture, instead of configured ones")
+	flag.Parse()
+
 	initLogger()
 	err := loadConfiguration()
-	if err != nil {
+	if err != nil && !(*demo && errors.Is(err, os.ErrNotExist)) {
 		log.Fatal("Can't load configuration")
 	}
+	if *demo {
+		aConfiguration.Profiles = []profile{demoProfile()}
+	}
+	if *dryRun {
+		aConfiguration.DryRun = true
+	}
+	for i := range aConfiguration.Profiles {
+		aConfiguration.Profiles[i] = aConfiguration.Profiles[i].setDryRun(aConfiguration.DryRun)
+	}
+
+	if flag.Arg(0) == "export" {
+		if err := runExport(flag.Args()[1:]); err != nil {
+			log.Printf("Export failed, err: %s", err.Error())
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := codecs.Load(aConfiguration.Schemas); err != nil {
+		log.Fatalf("Can't load schemas, err: %s", err.Error())
+	}
+
+	aJournal, unreconciled := openJournal()
+	defer aJournal.Close()
 
 	sqlQueryOptions := make([]state.SelectableOption, 0)
 	for _, db := range aConfiguration.Databases {
@@ -87,14 +214,48 @@ func main() {
 		}
 	}
 
-	aStore = store.NewStore(state.State{
+	aStore := store.NewStore(initialState(&aConfiguration, sqlQueryOptions))
+	aSession, err := newSession(&aConfiguration, aStore, aJournal, unreconciled)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer aSession.close()
+	aStore.AddReducer(aSession.reduce)
+
+	appExit := make(chan bool, 1)
+	appExitFunc := func() {
+		appExit <- true
+	}
+
+	aLayout, err := layout.New(aStore, appExitFunc)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	go aLayout.Show()
+
+	// Blocking until exit signal will be received
+	<-appExit
+}
+
+// initialState shows the first profile of configuration with no messages loaded
+func initialState(c *configuration, sqlQueryOptions []state.SelectableOption) state.State {
+	profileOptions := make([]state.SelectableOption, 0, len(c.Profiles))
+	for i, p := range c.Profiles {
+		profileOptions = append(profileOptions, state.SelectableOption{
+			Text:  getProfileOptionText(p),
+			Value: i,
+		})
+	}
+
+	return state.State{
 		Messages:           []state.MessageStruct{},
 		SelectedMessageIdx: -1,
 		Notification:       nil,
 		AppActions:         []string{},
 		ShowHeaders:        false,
 		FocusedViews:       commons.NewStack(layout.DefaultView),
-		Debug:              aConfiguration.Debug,
+		Debug:              c.Debug,
 		InputMode:          false,
 		SelectQueryPopup: state.SelectQueryPopupData{
 			Text:        "Choose a query to run",
@@ -104,141 +265,242 @@ func main() {
 		FillQueryParamsPopup: state.FillQueryParamsPopupData{
 			SelectedParamIdx: 0,
 		},
+		SelectProfilePopup: state.SelectQueryPopupData{
+			Text:        "Loaded messages will be released before switching",
+			Options:     profileOptions,
+			SelectedIdx: 0,
+		},
+		SelectQueuePopup: state.SelectQueryPopupData{
+			Text:        "Choose DLQ to use; its source queue becomes a target one",
+			Options:     []state.SelectableOption{},
+			SelectedIdx: 0,
+		},
+		MoveToPopup: state.SelectQueryPopupData{
+			Text:        "Choose where to move the message",
+			Options:     getDestinationOptions(c.Profiles[0]),
+			SelectedIdx: 0,
+		},
+		ActiveProfile: c.Profiles[0].Name,
+		DryRun:        c.DryRun,
+		GroupKeys:     getGroupKeys(c),
+	}
+}
+
+func getGroupKeys(c *configuration) []string {
+	if len(c.GroupBy) > 0 {
+		return c.GroupBy
+	}
+	return []string{"x-death[0].reason", "x-first-death-queue"}
+}
+
+func getProfileOptionText(p profile) string {
+	if p.isKafka() {
+		return fmt.Sprintf("%s (%s: %s)", p.Name, strings.Join(p.Kafka.Brokers, ","), p.Kafka.Topic)
+	}
+	if p.isMemory() {
+		return fmt.Sprintf("%s (in memory: %s)", p.Name, p.fixture())
+	}
+	return fmt.Sprintf("%s (%s/%s: %s)", p.Name, p.Rabbitmq.Host, p.Rabbitmq.Vhost, p.Rabbitmq.Dlq)
+}
+
+func getQueueOptions(queues []management.Queue) []state.SelectableOption {
+	options := make([]state.SelectableOption, 0, len(queues))
+	for _, q := range queues {
+		text := fmt.Sprintf("%s (%d msgs, %d consumers)", q.Name, q.Messages, q.Consumers)
+		if q.IsDeadLetterTarget() {
+			text = fmt.Sprintf("DLQ %s ← %s", text, strings.Join(q.DeadLetteredFrom, ", "))
+		}
+		options = append(options, state.SelectableOption{
+			Text:  text,
+			Value: q,
+		})
+	}
+	return options
+}
+
+var bulkJournalActions = map[state.BulkOperationKind]journal.Action{
+	state.BulkRequeue: journal.Requeued,
+	state.BulkDrop:    journal.Dropped,
+	state.BulkMove:    journal.Moved,
+}
+
+var processedNotices = map[state.BulkOperationKind]string{
+	state.BulkRequeue: "requeued",
+	state.BulkDrop:    "dropped",
+	state.BulkMove:    "moved",
+}
+
+func messageIds(messages []state.MessageStruct) []uint64 {
+	ids := make([]uint64, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.Id)
+	}
+	return ids
+}
+
+// openJournal finds messages, which were left unreconciled by a previous session, and opens journal for a new one.
+// Journal is truncated, if there is nothing to reconcile. Nil journal is returned, if it can't be opened
+func openJournal() (*journal.Journal, []journal.Entry) {
+	path := aConfiguration.Journal
+	if path == "" {
+		path = defaultJournal
+	}
+
+	unreconciled, err := journal.Unreconciled(path)
+	if err != nil {
+		log.Printf("Can't read journal %s, err: %s", path, err.Error())
+	} else if len(unreconciled) == 0 {
+		if err = journal.Truncate(path); err != nil {
+			log.Printf("Can't truncate journal %s, err: %s", path, err.Error())
+		}
+	} else {
+		log.Printf("Journal %s has %d unreconciled messages", path, len(unreconciled))
+	}
+
+	aJournal, err := journal.Open(path)
+	if err != nil {
+		log.Printf("Can't open journal %s, taken messages won't be journaled, err: %s", path, err.Error())
+	}
+	return aJournal, unreconciled
+}
+
+// notifyDryRun reminds, that operation has changed only local state
+func notifyDryRun(s *state.State, operation string) {
+	if s.DryRun {
+		notify(s, "DRY RUN: message "+operation+" locally, nothing was sent")
+	}
+}
+
+func notify(s *state.State, value string) {
+	s.Notification = &state.NotificationStruct{
+		Value: value,
+		At:    time.Now(),
+	}
+}
+
+// takenMessages returns messages, taken from the DLQ, leaving out imported ones
+func takenMessages(messages []state.MessageStruct) []state.MessageStruct {
+	return commons.Filter(messages, func(m state.MessageStruct) bool {
+		return !m.Imported
 	})
+}
 
-	aStore.AddReducer(func(s *state.State, a store.Action) {
-		switch action := a.(type) {
-		case state.NextMessage:
-			if len(s.Messages) > s.SelectedMessageIdx+1 {
-				s.SelectedMessageIdx++
-			}
-		case state.PrevMessage:
-			if s.SelectedMessageIdx > 0 {
-				s.SelectedMessageIdx--
-			}
-		case state.LoadMessages:
-			if s.Messages != nil && len(s.Messages) > 0 {
-				if err := rabbitmq.PublishMessagesToDlq(s.Messages, aConfiguration.Rabbitmq); err != nil {
-					log.Printf("Failed to requeue messages, err: %s", err.Error())
-				}
-			}
-			if messages, err := rabbitmq.LoadMessages(aConfiguration.Rabbitmq); err != nil {
-				log.Printf("Failed to load messages, %s", err.Error())
-			} else {
-				s.Messages = messages
-			}
-		case state.RequeueMessages:
-			if s.Messages != nil && len(s.Messages) > 0 {
-				if err := rabbitmq.PublishMessagesToDlq(s.Messages, aConfiguration.Rabbitmq); err != nil {
-					log.Printf("Failed to requeue messages, err: %s", err.Error())
-				}
-			}
-		case state.RequeueMessage:
-			if len(s.Messages) >= action.MessageIdx {
-				log.Printf("Invalid message idx: %d, there is only %d messages loaded", action.MessageIdx, len(s.Messages))
-			}
+func isImported(m state.MessageStruct) bool {
+	return m.Imported
+}
 
-			if err := rabbitmq.PublishMessageToQueue(s.Messages[action.MessageIdx], aConfiguration.Rabbitmq); err != nil {
-				log.Printf("Failed to requeue message, err: %s", err.Error())
-			}
+func isValidMessageIdx(s *state.State, idx int) bool {
+	if idx < 0 || idx >= len(s.Messages) {
+		log.Printf("Invalid message idx: %d, there is only %d messages loaded", idx, len(s.Messages))
+		return false
+	}
+	return true
+}
 
-			s.Messages = append(s.Messages[:action.MessageIdx], s.Messages[action.MessageIdx+1:]...)
-			if s.SelectedMessageIdx >= len(s.Messages) {
-				s.SelectedMessageIdx--
-			}
-		case state.ToggleShowHeaders:
-			s.ShowHeaders = !s.ShowHeaders
-		case state.DropMessage:
-			s.Messages = append(s.Messages[:action.MessageIdx], s.Messages[action.MessageIdx+1:]...)
-			if s.SelectedMessageIdx >= len(s.Messages) {
-				s.SelectedMessageIdx--
-			}
-		case state.QueriesListNextOption:
-			if s.SelectQueryPopup.SelectedIdx < len(s.SelectQueryPopup.Options)-1 {
-				s.SelectQueryPopup.SelectedIdx += 1
-			}
-		case state.QueriesListPrevOption:
-			if s.SelectQueryPopup.SelectedIdx > 0 {
-				s.SelectQueryPopup.SelectedIdx -= 1
-			}
-		case state.ShowFillQueryParamsPopup:
-			context, ok := s.SelectQueryPopup.Options[s.SelectQueryPopup.SelectedIdx].Value.(state.QueryContext)
-			if !ok {
-				log.Printf("Can't get query context from selected option value - invalid type")
-				break
-			}
-			s.FillQueryParamsPopup = state.FillQueryParamsPopupData{
-				Ctx:              context,
-				SelectedParamIdx: 0,
-			}
-		case state.FillQueryParamsPopupNextField:
-			if s.FillQueryParamsPopup.SelectedParamIdx < len(s.FillQueryParamsPopup.Ctx.Params)-1 {
-				s.FillQueryParamsPopup.SelectedParamIdx++
-			}
-		case state.FillQueryParamsPopupPrevField:
-			if s.FillQueryParamsPopup.SelectedParamIdx > 0 {
-				s.FillQueryParamsPopup.SelectedParamIdx--
-			}
-		case state.StopInputMode:
-			s.InputMode = false
-		case state.StartInputMode:
-			s.InputMode = true
-		case state.RunSqlQuery:
-			ctx := s.FillQueryParamsPopup.Ctx
-			params := make(map[string]string)
-			for _, p := range ctx.Params {
-				params[p.Name] = fmt.Sprintf(p.Format, p.Value)
-			}
-			results := ctx.Db.Query(ctx.Query, params)
+func removeMessage(s *state.State, idx int) {
+	s.Messages = append(s.Messages[:idx], s.Messages[idx+1:]...)
+	if s.SelectedMessageIdx > idx {
+		s.SelectedMessageIdx--
+	}
+	if s.SelectedMessageIdx >= len(s.Messages) {
+		s.SelectedMessageIdx = len(s.Messages) - 1
+	}
+	if !s.Filter.Matches(currentMessage(s)) {
+		s.SelectedMessageIdx = nextVisibleMessageIdx(s, 1)
+	}
+}
 
-			s.DatabaseOutputs = &state.DatabaseData{
-				Results: results,
-			}
+// bulkOperationRunningNotice refuses single message operations and edits during a bulk operation, as it processes
+// a snapshot of marked messages, so a message would be processed twice or its edit would be lost
+const bulkOperationRunningNotice = "Can't change messages while a bulk operation is in progress"
 
-			sqlViewRows := layout.CalculateRows(results)
+// messageProcessingNotice refuses operations and edits of a message, which is requeued, dropped or moved already
+const messageProcessingNotice = "Message is being processed, wait for the broker"
 
-			s.SqlResultsView = &state.SqlResultsViewData{
-				DX:    0,
-				DY:    0,
-				MaxDX: len(sqlViewRows[0]),
-				MaxDY: len(sqlViewRows),
-				Rows:  sqlViewRows,
-			}
-		case state.HideSqlResults:
-			s.DatabaseOutputs = nil
-		case state.SqlViewScrollDown:
-			if s.SqlResultsView.DY < s.SqlResultsView.MaxDY {
-				s.SqlResultsView.DY++
-			}
-		case state.SqlViewScrollUp:
-			if s.SqlResultsView.DY > 0 {
-				s.SqlResultsView.DY--
-			}
-		case state.SqlViewScrollRight:
-			if s.SqlResultsView.DX < s.SqlResultsView.MaxDX {
-				s.SqlResultsView.DX++
+func isBulkOperationRunning(s *state.State) bool {
+	return s.BulkOperation != nil && !s.BulkOperation.IsFinished()
+}
+
+func currentMessage(s *state.State) state.MessageStruct {
+	if s.SelectedMessageIdx < 0 || s.SelectedMessageIdx >= len(s.Messages) {
+		return state.MessageStruct{}
+	}
+	return s.Messages[s.SelectedMessageIdx]
+}
+
+// nextVisibleMessageIdx finds the closest message in the given direction, which matches the filter.
+// If there are no such messages, it tries the opposite direction, and returns -1, if nothing is visible at all
+func nextVisibleMessageIdx(s *state.State, direction int) int {
+	visibleIdx := s.VisibleMessagesIdx()
+	if len(visibleIdx) == 0 {
+		return -1
+	}
+
+	if direction > 0 {
+		for _, i := range visibleIdx {
+			if i > s.SelectedMessageIdx {
+				return i
 			}
-		case state.SqlViewScrollLeft:
-			if s.SqlResultsView.DX > 0 {
-				s.SqlResultsView.DX--
+		}
+	} else {
+		for j := len(visibleIdx) - 1; j >= 0; j-- {
+			if visibleIdx[j] < s.SelectedMessageIdx {
+				return visibleIdx[j]
 			}
 		}
-	})
+	}
 
-	appExit := make(chan bool, 1)
-	appExitFunc := func() {
-		appExit <- true
+	// Staying on current message, if it's visible, or jumping to the closest visible one
+	for _, i := range visibleIdx {
+		if i == s.SelectedMessageIdx {
+			return i
+		}
 	}
+	if direction > 0 {
+		return visibleIdx[len(visibleIdx)-1]
+	}
+	return visibleIdx[0]
+}
 
-	aLayout, err = layout.New(aStore, appExitFunc)
-	if err != nil {
-		log.Fatal(err)
+func getDestinationOptions(p profile) []state.SelectableOption {
+	if p.isKafka() {
+		options := make([]state.SelectableOption, 0, len(p.Kafka.Destinations))
+		for _, d := range p.Kafka.Destinations {
+			options = append(options, state.SelectableOption{
+				Text:  fmt.Sprintf("%s (%s)", d.Name, d.Destination()),
+				Value: d.Destination(),
+			})
+		}
+		return options
 	}
 
-	go aLayout.Show()
+	options := make([]state.SelectableOption, 0, len(p.Rabbitmq.Destinations))
+	for _, d := range p.Rabbitmq.Destinations {
+		options = append(options, state.SelectableOption{
+			Text:  fmt.Sprintf("%s (%s)", d.Name, d.Destination()),
+			Value: d.Destination(),
+		})
+	}
+	return options
+}
 
-	// Blocking until exit signal will be received
-	<-appExit
+// nextMessageId is safe to call from loading goroutines and reducers alike
+func nextMessageId() uint64 {
+	return atomic.AddUint64(&lastMessageId, 1)
+}
+
+// newBroker returns an error only, if broker can't be created at all; connection failures are reported to listener
+func newBroker(p profile, listener state.StatusListener) (state.Broker, error) {
+	if p.isKafka() {
+		log.Printf("Connecting to Kafka, profile %s", p.Name)
+		return kafka.Connect(p.Kafka, listener), nil
+	}
+	if p.isMemory() {
+		log.Printf("Seeding in-memory broker from %s fixture, profile %s", p.fixture(), p.Name)
+		return memory.Connect(p.Memory, p.Rabbitmq, listener)
+	}
+	log.Printf("Connecting to RabbitMQ, profile %s", p.Name)
+	return rabbitmq.Connect(p.Rabbitmq, listener), nil
 }
 
 func loadConfiguration() error {
@@ -252,9 +514,26 @@ func loadConfiguration() error {
 		return err
 	}
 
+	// Single 'rabbitmq' or 'kafka' section is treated as the only profile
+	if len(aConfiguration.Profiles) == 0 {
+		aConfiguration.Profiles = []profile{{
+			Name:       "default",
+			Broker:     aConfiguration.Broker,
+			Rabbitmq:   aConfiguration.Rabbitmq,
+			Management: aConfiguration.Management,
+			Kafka:      aConfiguration.Kafka,
+			Memory:     aConfiguration.Memory,
+		}}
+	}
+
 	return nil
 }
 
+// demoProfile is the only profile in a demo mode. It uses 'memory' section of configuration, if there is one
+func demoProfile() profile {
+	return profile{Name: "demo", Broker: memoryBroker, Memory: aConfiguration.Memory}
+}
+
 func initLogger() {
 	file, err := os.OpenFile("logs.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
 	if err != nil {
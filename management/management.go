@@ -0,0 +1,195 @@
+package management
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const requestTimeout = 10 * time.Second
+
+// Configuration of RabbitMQ management plugin HTTP API
+type Configuration struct {
+	// Url of management plugin, e.g. http://localhost:15672
+	Url      string
+	User     string
+	Password string
+}
+
+type Queue struct {
+	Name      string
+	Messages  int
+	Consumers int
+	// DeadLetteredFrom lists queues, which dead-letter their messages into this one
+	DeadLetteredFrom []string
+}
+
+func (q Queue) IsDeadLetterTarget() bool {
+	return len(q.DeadLetteredFrom) > 0
+}
+
+type Client struct {
+	config Configuration
+	http   *http.Client
+}
+
+// New creates a management API client. If httpClient is nil, a default one with a timeout is used
+func New(c Configuration, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: requestTimeout}
+	}
+	return &Client{
+		config: c,
+		http:   httpClient,
+	}
+}
+
+type queueResponse struct {
+	Name                      string         `json:"name"`
+	Messages                  int            `json:"messages"`
+	Consumers                 int            `json:"consumers"`
+	Arguments                 map[string]any `json:"arguments"`
+	EffectivePolicyDefinition map[string]any `json:"effective_policy_definition"`
+}
+
+type exchangeResponse struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type bindingResponse struct {
+	Source          string `json:"source"`
+	Destination     string `json:"destination"`
+	DestinationType string `json:"destination_type"`
+	RoutingKey      string `json:"routing_key"`
+}
+
+// deadLettering returns dead letter exchange and routing key of a queue, configured either with arguments,
+// or with a policy. Arguments take precedence, just like in RabbitMQ itself
+func (q queueResponse) deadLettering() (exchange string, routingKey *string, ok bool) {
+	exchange, hasExchange := q.Arguments["x-dead-letter-exchange"].(string)
+	if !hasExchange {
+		exchange, hasExchange = q.EffectivePolicyDefinition["dead-letter-exchange"].(string)
+	}
+	if !hasExchange {
+		return "", nil, false
+	}
+
+	if key, hasKey := q.Arguments["x-dead-letter-routing-key"].(string); hasKey {
+		return exchange, &key, true
+	}
+	if key, hasKey := q.EffectivePolicyDefinition["dead-letter-routing-key"].(string); hasKey {
+		return exchange, &key, true
+	}
+	return exchange, nil, true
+}
+
+// routes tells, whether a binding of an exchange of the type routes messages, dead-lettered with the routing key.
+// Nil routing key means, that messages are dead-lettered with their original routing keys, which are unknown
+func (b bindingResponse) routes(exchangeType string, routingKey *string) bool {
+	switch {
+	case routingKey == nil, exchangeType == "fanout":
+		return true
+	case exchangeType == "topic" && b.RoutingKey == "#":
+		return true
+	case exchangeType == "headers":
+		// Headers exchange routes by message headers, which are unknown, rather than by a routing key
+		return true
+	default:
+		// Direct exchange, including an empty binding key, which routes only an empty routing key
+		return b.RoutingKey == *routingKey
+	}
+}
+
+// ListQueues lists queues in a vhost with their stats and flags ones, which are dead-letter targets for other queues.
+// Dead-letter targets go first.
+func (c *Client) ListQueues(vhost string) ([]Queue, error) {
+	queues := make([]queueResponse, 0)
+	if err := c.get("/api/queues/"+url.PathEscape(vhost)+
+		"?columns=name,messages,consumers,arguments,effective_policy_definition", &queues); err != nil {
+		return nil, err
+	}
+
+	exchanges := make([]exchangeResponse, 0)
+	if err := c.get("/api/exchanges/"+url.PathEscape(vhost)+"?columns=name,type", &exchanges); err != nil {
+		return nil, err
+	}
+	exchangeTypes := make(map[string]string, len(exchanges))
+	for _, e := range exchanges {
+		exchangeTypes[e.Name] = e.Type
+	}
+
+	bindings := make([]bindingResponse, 0)
+	if err := c.get("/api/bindings/"+url.PathEscape(vhost), &bindings); err != nil {
+		return nil, err
+	}
+
+	deadLetteredFrom := make(map[string][]string)
+	for _, q := range queues {
+		exchange, routingKey, ok := q.deadLettering()
+		if !ok {
+			continue
+		}
+
+		if exchange == "" {
+			// Default exchange routes directly to a queue with the routing key name
+			if routingKey != nil {
+				deadLetteredFrom[*routingKey] = append(deadLetteredFrom[*routingKey], q.Name)
+			}
+			continue
+		}
+
+		for _, b := range bindings {
+			if b.Source != exchange || b.DestinationType != "queue" {
+				continue
+			}
+			if b.routes(exchangeTypes[exchange], routingKey) {
+				deadLetteredFrom[b.Destination] = append(deadLetteredFrom[b.Destination], q.Name)
+			}
+		}
+	}
+
+	result := make([]Queue, 0, len(queues))
+	for _, q := range queues {
+		result = append(result, Queue{
+			Name:             q.Name,
+			Messages:         q.Messages,
+			Consumers:        q.Consumers,
+			DeadLetteredFrom: deadLetteredFrom[q.Name],
+		})
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].IsDeadLetterTarget() != result[j].IsDeadLetterTarget() {
+			return result[i].IsDeadLetterTarget()
+		}
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+func (c *Client) get(path string, result any) error {
+	request, err := http.NewRequest(http.MethodGet, strings.TrimRight(c.config.Url, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	request.SetBasicAuth(c.config.User, c.config.Password)
+	request.Header.Set("Accept", "application/json")
+
+	response, err := c.http.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("management API responded with %s to %s", response.Status, path)
+	}
+
+	return json.NewDecoder(response.Body).Decode(result)
+}
@@ -0,0 +1,196 @@
+package management
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// newServer imitates management API of a vhost with the given queues, exchanges and bindings
+func newServer(t *testing.T, vhost string, queues []queueResponse, exchanges []exchangeResponse,
+	bindings []bindingResponse) *httptest.Server {
+	t.Helper()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "guest" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// Vhost is escaped in path, e.g. default "/" one is "%2F"
+		switch r.URL.EscapedPath() {
+		case "/api/queues/" + vhost:
+			_ = json.NewEncoder(w).Encode(queues)
+		case "/api/exchanges/" + vhost:
+			_ = json.NewEncoder(w).Encode(exchanges)
+		case "/api/bindings/" + vhost:
+			_ = json.NewEncoder(w).Encode(bindings)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func listQueues(t *testing.T, server *httptest.Server, vhost string) []Queue {
+	t.Helper()
+	client := New(Configuration{Url: server.URL + "/", User: "guest", Password: "secret"}, nil)
+	queues, err := client.ListQueues(vhost)
+	if err != nil {
+		t.Fatalf("ListQueues() error = %v", err)
+	}
+	return queues
+}
+
+func deadLetteredFrom(queues []Queue) map[string][]string {
+	result := make(map[string][]string)
+	for _, q := range queues {
+		result[q.Name] = q.DeadLetteredFrom
+	}
+	return result
+}
+
+func TestListQueuesDetectsDlqByArguments(t *testing.T) {
+	server := newServer(t, "orders",
+		[]queueResponse{
+			{Name: "orders", Messages: 3, Consumers: 1, Arguments: map[string]any{
+				"x-dead-letter-exchange":    "dlx",
+				"x-dead-letter-routing-key": "orders",
+			}},
+			{Name: "orders.dlq", Messages: 7},
+			{Name: "other.dlq"},
+		},
+		[]exchangeResponse{{Name: "dlx", Type: "direct"}},
+		[]bindingResponse{
+			{Source: "dlx", Destination: "orders.dlq", DestinationType: "queue", RoutingKey: "orders"},
+			{Source: "dlx", Destination: "other.dlq", DestinationType: "queue", RoutingKey: "other"},
+			{Source: "dlx", Destination: "audit", DestinationType: "exchange", RoutingKey: "orders"},
+		})
+
+	queues := listQueues(t, server, "orders")
+
+	want := []Queue{
+		{Name: "orders.dlq", Messages: 7, DeadLetteredFrom: []string{"orders"}},
+		{Name: "orders", Messages: 3, Consumers: 1},
+		{Name: "other.dlq"},
+	}
+	if !reflect.DeepEqual(queues, want) {
+		t.Errorf("ListQueues() = %+v, want %+v", queues, want)
+	}
+}
+
+func TestListQueuesDetectsDlqByPolicy(t *testing.T) {
+	server := newServer(t, "%2F",
+		[]queueResponse{
+			{Name: "payments", EffectivePolicyDefinition: map[string]any{"dead-letter-exchange": "dlx"}},
+			{Name: "invoices",
+				Arguments: map[string]any{"x-dead-letter-routing-key": "invoices"},
+				EffectivePolicyDefinition: map[string]any{
+					"dead-letter-exchange":    "dlx",
+					"dead-letter-routing-key": "ignored",
+				}},
+			{Name: "payments.dlq"},
+			{Name: "invoices.dlq"},
+			{Name: "catch-all.dlq"},
+			{Name: "ignored.dlq"},
+		},
+		[]exchangeResponse{{Name: "dlx", Type: "topic"}},
+		[]bindingResponse{
+			{Source: "dlx", Destination: "payments.dlq", DestinationType: "queue", RoutingKey: "payments"},
+			{Source: "dlx", Destination: "invoices.dlq", DestinationType: "queue", RoutingKey: "invoices"},
+			{Source: "dlx", Destination: "catch-all.dlq", DestinationType: "queue", RoutingKey: "#"},
+			{Source: "dlx", Destination: "ignored.dlq", DestinationType: "queue", RoutingKey: "ignored"},
+		})
+
+	got := deadLetteredFrom(listQueues(t, server, "/"))
+
+	want := map[string][]string{
+		// Without a dead letter routing key, original routing key is unknown, so every binding of exchange matches
+		"payments.dlq":  {"payments"},
+		"invoices.dlq":  {"payments", "invoices"},
+		"catch-all.dlq": {"payments", "invoices"},
+		// Routing key argument takes precedence over a policy one
+		"ignored.dlq": {"payments"},
+		"payments":    nil,
+		"invoices":    nil,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ListQueues() dead-lettered from = %v, want %v", got, want)
+	}
+}
+
+func TestListQueuesDetectsDlqOfDefaultExchange(t *testing.T) {
+	server := newServer(t, "orders",
+		[]queueResponse{
+			{Name: "orders", Arguments: map[string]any{
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": "orders.parking-lot",
+			}},
+			// Default exchange without routing key dead-letters with original routing keys, which are unknown
+			{Name: "payments", Arguments: map[string]any{"x-dead-letter-exchange": ""}},
+			{Name: "orders.parking-lot"},
+		},
+		[]exchangeResponse{{Name: "", Type: "direct"}},
+		[]bindingResponse{
+			{Source: "", Destination: "orders", DestinationType: "queue", RoutingKey: "orders"},
+		})
+
+	got := deadLetteredFrom(listQueues(t, server, "orders"))
+
+	want := map[string][]string{
+		"orders.parking-lot": {"orders"},
+		"orders":             nil,
+		"payments":           nil,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ListQueues() dead-lettered from = %v, want %v", got, want)
+	}
+}
+
+func TestListQueuesMatchesBindingKeysByExchangeType(t *testing.T) {
+	server := newServer(t, "orders",
+		[]queueResponse{
+			{Name: "orders", Arguments: map[string]any{
+				"x-dead-letter-exchange":    "direct-dlx",
+				"x-dead-letter-routing-key": "orders",
+			}},
+			{Name: "payments", Arguments: map[string]any{
+				"x-dead-letter-exchange":    "fanout-dlx",
+				"x-dead-letter-routing-key": "payments",
+			}},
+			{Name: "orders.dlq"},
+			{Name: "notifications"},
+			{Name: "payments.dlq"},
+		},
+		[]exchangeResponse{{Name: "direct-dlx", Type: "direct"}, {Name: "fanout-dlx", Type: "fanout"}},
+		[]bindingResponse{
+			{Source: "direct-dlx", Destination: "orders.dlq", DestinationType: "queue", RoutingKey: "orders"},
+			// Empty binding key of a direct exchange routes only messages with an empty routing key
+			{Source: "direct-dlx", Destination: "notifications", DestinationType: "queue", RoutingKey: ""},
+			{Source: "fanout-dlx", Destination: "payments.dlq", DestinationType: "queue", RoutingKey: "anything"},
+		})
+
+	got := deadLetteredFrom(listQueues(t, server, "orders"))
+
+	want := map[string][]string{
+		"orders.dlq":    {"orders"},
+		"payments.dlq":  {"payments"},
+		"notifications": nil,
+		"orders":        nil,
+		"payments":      nil,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ListQueues() dead-lettered from = %v, want %v", got, want)
+	}
+}
+
+func TestListQueuesFailsOnErrorResponse(t *testing.T) {
+	server := newServer(t, "orders", []queueResponse{}, []exchangeResponse{}, []bindingResponse{})
+	client := New(Configuration{Url: server.URL, User: "guest", Password: "wrong"}, nil)
+
+	if _, err := client.ListQueues("orders"); err == nil {
+		t.Error("ListQueues() error = nil, want unauthorized error")
+	}
+}
@@ -0,0 +1,130 @@
+package memory
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/streadway/amqp"
+
+	"DeadRabbit/rabbitmq"
+	"DeadRabbit/state"
+)
+
+// queue keeps ready messages in order they were published
+type queue struct {
+	name     string
+	messages []state.MessageStruct
+	// Dead-lettered messages are published to this exchange and routing key, original one is kept, if it's empty
+	deadLetterExchange   string
+	deadLetterRoutingKey string
+	// reject simulates a failing consumer, which rejects every published message without requeueing
+	reject bool
+}
+
+// binding routes messages from an exchange to a queue by an exact routing key or by any key, if it's "#"
+type binding struct {
+	exchange   string
+	routingKey string
+	queue      string
+}
+
+// declare returns an existing queue or creates one, which dead-letters messages to the DLQ
+func (b *Broker) declare(name string) *queue {
+	if q, ok := b.queues[name]; ok {
+		return q
+	}
+	q := &queue{name: name}
+	if name != b.config.Dlq {
+		q.deadLetterRoutingKey = b.config.Dlq
+	}
+	b.queues[name] = q
+	return q
+}
+
+// route returns queues, a message is delivered to. Default exchange routes by queue name, as RabbitMQ does.
+// Should be called under lock
+func (b *Broker) route(exchange, routingKey string) []*queue {
+	if exchange == "" {
+		if q, ok := b.queues[routingKey]; ok {
+			return []*queue{q}
+		}
+		return nil
+	}
+
+	queues := make([]*queue, 0)
+	for _, bound := range b.bindings {
+		if bound.exchange == exchange && (bound.routingKey == routingKey || bound.routingKey == "#") {
+			queues = append(queues, b.declare(bound.queue))
+		}
+	}
+	return queues
+}
+
+// deliver publishes a message to the exchange; rejecting queues dead-letter it right away.
+// Already dead-lettered messages aren't rejected again, so misconfigured fixture can't make a loop.
+// Should be called under lock
+func (b *Broker) deliver(exchange, routingKey string, message state.MessageStruct, deadLettered bool) error {
+	queues := b.route(exchange, routingKey)
+	if len(queues) == 0 {
+		return fmt.Errorf("%w: %s/%s: 312 NO_ROUTE", rabbitmq.ErrNotRoutable, exchange, routingKey)
+	}
+
+	for _, q := range queues {
+		if q.reject && !deadLettered {
+			b.deadLetter(q, message, "rejected", exchange, routingKey)
+			continue
+		}
+		q.messages = append(q.messages, message)
+	}
+	return nil
+}
+
+// deadLetter moves a message out of the queue the way RabbitMQ does: "x-death" entry of the queue and reason
+// is counted and moved to the top, "x-first-death-*" headers are set once. Should be called under lock
+func (b *Broker) deadLetter(q *queue, message state.MessageStruct, reason, exchange, routingKey string) {
+	message.Headers = withDeath(message.Headers, q.name, reason, exchange, routingKey)
+
+	target := routingKey
+	if q.deadLetterRoutingKey != "" {
+		target = q.deadLetterRoutingKey
+	}
+	if err := b.deliver(q.deadLetterExchange, target, message, true); err != nil {
+		log.Printf("Message, dead-lettered from %s, is lost, err: %s", q.name, err.Error())
+	}
+}
+
+func withDeath(headers map[string]any, queue, reason, exchange, routingKey string) map[string]any {
+	result := make(map[string]any, len(headers)+4)
+	for key, value := range headers {
+		result[key] = value
+	}
+
+	deaths, _ := headers["x-death"].([]any)
+	updated := make([]any, 0, len(deaths)+1)
+	death := amqp.Table{
+		"queue":        queue,
+		"reason":       reason,
+		"exchange":     exchange,
+		"routing-keys": []any{routingKey},
+		"count":        int64(1),
+		"time":         time.Now(),
+	}
+	for _, d := range deaths {
+		previous, ok := d.(amqp.Table)
+		if ok && previous["queue"] == queue && previous["reason"] == reason {
+			count, _ := previous["count"].(int64)
+			death["count"] = count + 1
+			continue
+		}
+		updated = append(updated, d)
+	}
+	result["x-death"] = append([]any{death}, updated...)
+
+	if _, ok := result["x-first-death-queue"]; !ok {
+		result["x-first-death-queue"] = queue
+		result["x-first-death-reason"] = reason
+		result["x-first-death-exchange"] = exchange
+	}
+	return result
+}
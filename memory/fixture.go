@@ -0,0 +1,156 @@
+package memory
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v2"
+
+	"DeadRabbit/demo"
+	"DeadRabbit/rabbitmq"
+	"DeadRabbit/state"
+)
+
+// Fixture describes queues, bindings and messages, the broker is seeded with
+type Fixture struct {
+	// Dlq and Queue are used, unless they are configured in the profile
+	Dlq      string
+	Queue    string
+	Queues   []QueueFixture
+	Bindings []BindingFixture
+	Messages []MessageFixture
+}
+
+type QueueFixture struct {
+	Name                 string
+	DeadLetterExchange   string `yaml:"deadLetterExchange"`
+	DeadLetterRoutingKey string `yaml:"deadLetterRoutingKey"`
+	// Reject makes every message, published to the queue, to be dead-lettered, e.g. to see how replays pile up
+	Reject bool
+}
+
+type BindingFixture struct {
+	Exchange   string
+	RoutingKey string `yaml:"routingKey"`
+	Queue      string
+}
+
+// MessageFixture is a message, which was published with the exchange and routing key to the queue
+// and then dead-lettered from it the given number of times
+type MessageFixture struct {
+	// Queue, message was dead-lettered from; Fixture.Queue by default
+	Queue string
+	// Exchange and RoutingKey, message was originally published with; default exchange and Queue by default
+	Exchange   string
+	RoutingKey string `yaml:"routingKey"`
+	// Reason is "rejected" by default; RabbitMQ also uses "expired", "maxlen" and "delivery_limit"
+	Reason string
+	// Deaths is how many times message was dead-lettered; 1 by default
+	Deaths     int
+	Body       string
+	Headers    map[string]any
+	Properties rabbitmq.PropertiesOverrides
+}
+
+// LoadFixture reads a YAML fixture file; empty path stands for the built-in demo fixture
+func LoadFixture(path string) (Fixture, error) {
+	if path == "" {
+		return ParseFixture(demo.Fixture)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Fixture{}, err
+	}
+
+	fixture, err := ParseFixture(content)
+	if err != nil {
+		return Fixture{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return fixture, nil
+}
+
+// ParseFixture parses a YAML fixture, e.g. an embedded one
+func ParseFixture(content []byte) (Fixture, error) {
+	var fixture Fixture
+	if err := yaml.Unmarshal(content, &fixture); err != nil {
+		return Fixture{}, err
+	}
+	return fixture, nil
+}
+
+// seed declares queues and bindings of the fixture and dead-letters its messages. Should be called under lock
+func (b *Broker) seed(fixture Fixture) {
+	b.declare(b.config.Dlq)
+	if b.config.Queue != "" {
+		b.declare(b.config.Queue)
+	}
+	for _, qf := range fixture.Queues {
+		q := b.declare(qf.Name)
+		q.deadLetterExchange = qf.DeadLetterExchange
+		if qf.DeadLetterExchange != "" || qf.DeadLetterRoutingKey != "" {
+			q.deadLetterRoutingKey = qf.DeadLetterRoutingKey
+		}
+		q.reject = qf.Reject
+	}
+	for _, bf := range fixture.Bindings {
+		b.declare(bf.Queue)
+		b.bindings = append(b.bindings, binding{exchange: bf.Exchange, routingKey: bf.RoutingKey, queue: bf.Queue})
+	}
+
+	for _, mf := range fixture.Messages {
+		origin := mf.Queue
+		if origin == "" {
+			origin = b.config.Queue
+		}
+		routingKey := mf.RoutingKey
+		if mf.Exchange == "" && routingKey == "" {
+			routingKey = origin
+		}
+		reason := mf.Reason
+		if reason == "" {
+			reason = "rejected"
+		}
+		deaths := mf.Deaths
+		if deaths <= 0 {
+			deaths = 1
+		}
+
+		headers := make(map[string]any, len(mf.Headers))
+		for key, value := range mf.Headers {
+			headers[key] = fromYaml(value)
+		}
+		message := state.MessageStruct{
+			Body:       mf.Body,
+			Headers:    headers,
+			Properties: mf.Properties.Apply(state.MessageProperties{}),
+		}
+		q := b.declare(origin)
+		for i := 1; i < deaths; i++ {
+			// Message was replayed back to the queue and has died there once again
+			message.Headers = withDeath(message.Headers, origin, reason, mf.Exchange, routingKey)
+		}
+		b.deadLetter(q, message, reason, mf.Exchange, routingKey)
+	}
+}
+
+// fromYaml converts maps, decoded by YAML, to string-keyed ones, as AMQP headers are
+func fromYaml(value any) any {
+	switch v := value.(type) {
+	case map[any]any:
+		table := make(map[string]any, len(v))
+		for key, item := range v {
+			table[fmt.Sprint(key)] = fromYaml(item)
+		}
+		return table
+	case []any:
+		list := make([]any, len(v))
+		for i, item := range v {
+			list[i] = fromYaml(item)
+		}
+		return list
+	case int:
+		return int64(v)
+	default:
+		return v
+	}
+}
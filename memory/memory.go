@@ -0,0 +1,292 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"DeadRabbit/broker"
+	"DeadRabbit/compression"
+	"DeadRabbit/rabbitmq"
+	"DeadRabbit/replay"
+	"DeadRabbit/state"
+)
+
+const defaultPageSize = 200
+
+var ErrQueueNotFound = errors.New("queue not found")
+
+type Configuration struct {
+	// Fixture is a YAML file, the broker is seeded with on connecting; the built-in demo fixture by default
+	Fixture string
+}
+
+// Broker is an in-memory imitation of RabbitMQ: it keeps queues, routes messages by bindings and dead-letters
+// them with the same headers, so the app could be tried and tested without any server.
+// Everything is lost on closing.
+type Broker struct {
+	replay.Limit
+	broker.DryRunRecorder
+
+	config rabbitmq.Configuration
+
+	mu       sync.Mutex
+	queues   map[string]*queue
+	bindings []binding
+	// unacked are messages, loaded in a browse mode, in order they were loaded
+	unacked []delivery
+	lastTag uint64
+
+	done chan struct{}
+}
+
+type delivery struct {
+	tag     uint64
+	message state.MessageStruct
+}
+
+// Connect seeds a broker from the fixture; DLQ and target queue of the fixture are used, unless they are configured.
+// Fixture, which can't be loaded, is an error, as there is nothing to retry, unlike with a real connection
+func Connect(c Configuration, rc rabbitmq.Configuration, listener state.StatusListener) (*Broker, error) {
+	fixture, err := LoadFixture(c.Fixture)
+	if err != nil {
+		return nil, fmt.Errorf("can't load fixture: %w", err)
+	}
+	return New(fixture, rc, listener), nil
+}
+
+// New seeds a broker from the fixture, which is loaded already
+func New(fixture Fixture, rc rabbitmq.Configuration, listener state.StatusListener) *Broker {
+	if rc.Dlq == "" {
+		rc.Dlq = fixture.Dlq
+	}
+	if rc.Queue == "" {
+		rc.Queue = fixture.Queue
+	}
+	b := &Broker{
+		Limit:          replay.Limit{Max: rc.MaxReplays, OnLimit: rc.OnReplayLimit},
+		DryRunRecorder: broker.DryRunRecorder{Dlq: rc.Dlq},
+		config:         rc,
+		queues:         make(map[string]*queue),
+		done:           make(chan struct{}),
+	}
+
+	b.mu.Lock()
+	b.seed(fixture)
+	b.mu.Unlock()
+
+	// Status is reported asynchronously, as a real connection does
+	go listener(state.Connected, nil)
+
+	return b
+}
+
+func (b *Broker) Close() {
+	close(b.done)
+}
+
+// LoadMessages takes the next page of messages from the DLQ
+func (b *Broker) LoadMessages(ctx context.Context, onLoaded func([]state.MessageStruct)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	dlq, err := b.queue(b.config.Dlq)
+	if err != nil {
+		return err
+	}
+
+	batch := make([]state.MessageStruct, 0)
+	for len(batch) < b.PageSize() && len(dlq.messages) > 0 && ctx.Err() == nil {
+		message := dlq.messages[0]
+		dlq.messages = dlq.messages[1:]
+
+		loaded, err := compression.Decompress(message)
+		if err != nil {
+			log.Printf("Can't decompress message, err: %s", err.Error())
+			loaded.Error = err.Error()
+		}
+		loaded.ReplayCount = replay.Count(loaded.Headers)
+		loaded.Destination = b.ResolveDestination(loaded)
+		if b.IsBrowsing() {
+			b.lastTag++
+			loaded.DeliveryTag = b.lastTag
+			b.unacked = append(b.unacked, delivery{tag: b.lastTag, message: message})
+		}
+		batch = append(batch, loaded)
+	}
+
+	onLoaded(batch)
+	return ctx.Err()
+}
+
+// CountMessages returns number of messages in the DLQ, which are ready to be loaded
+func (b *Broker) CountMessages() (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	dlq, err := b.queue(b.config.Dlq)
+	if err != nil {
+		return 0, err
+	}
+	return len(dlq.messages), nil
+}
+
+func (b *Broker) PageSize() int {
+	if b.config.PageSize <= 0 {
+		return defaultPageSize
+	}
+	return b.config.PageSize
+}
+
+// ReleaseMessages puts unacknowledged messages back on their positions in a browse mode
+// or publishes them to the DLQ in a drain mode
+func (b *Broker) ReleaseMessages(messages []state.MessageStruct) error {
+	if !b.IsBrowsing() {
+		return b.RestoreMessages(messages)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	dlq, err := b.queue(b.config.Dlq)
+	if err != nil {
+		return err
+	}
+	released := make([]state.MessageStruct, 0, len(b.unacked)+len(dlq.messages))
+	for _, d := range b.unacked {
+		released = append(released, d.message)
+	}
+	dlq.messages = append(released, dlq.messages...)
+	b.unacked = nil
+	return nil
+}
+
+// AckMessage removes a loaded message from the DLQ for good
+func (b *Broker) AckMessage(message state.MessageStruct) error {
+	if message.DeliveryTag == 0 {
+		return nil
+	}
+	if b.config.DryRun {
+		b.RecordDryRun(state.DryRunOperation{
+			Operation:   "ack",
+			MessageId:   message.Properties.MessageId,
+			DeliveryTag: message.DeliveryTag,
+		})
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, d := range b.unacked {
+		if d.tag == message.DeliveryTag {
+			b.unacked = append(b.unacked[:i], b.unacked[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown delivery tag %d", message.DeliveryTag)
+}
+
+// RequeueMessage publishes a message to its destination, stamped with replay headers, and removes it from the DLQ
+func (b *Broker) RequeueMessage(message state.MessageStruct) error {
+	if err := b.Limit.Check(message); err != nil {
+		return err
+	}
+	message.Headers = replay.Stamp(message, b.config.Operator)
+	if message.Destination.Exchange == "" && message.Destination.RoutingKey == "" {
+		return fmt.Errorf("can't resolve where to replay the message to")
+	}
+	message.Properties = b.config.OverrideProperties.Apply(message.Properties)
+	if err := b.publish(message.Destination, message); err != nil {
+		return err
+	}
+
+	return b.AckMessage(message)
+}
+
+// MoveMessage publishes a message as is to the given destination, marking where it was moved from,
+// and removes it from the DLQ
+func (b *Broker) MoveMessage(message state.MessageStruct, destination state.Destination) error {
+	message.Headers = broker.MarkMovedFrom(message.Headers, b.config.Dlq)
+
+	if err := b.publish(destination, message); err != nil {
+		return err
+	}
+
+	return b.AckMessage(message)
+}
+
+// RestoreMessages publishes messages back to the DLQ as they are
+func (b *Broker) RestoreMessages(messages []state.MessageStruct) error {
+	for _, message := range messages {
+		if err := b.publish(state.Destination{RoutingKey: b.config.Dlq}, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Broker) IsBrowsing() bool {
+	return b.config.Mode != rabbitmq.DrainMode || b.config.DryRun
+}
+
+// ResolveDestination finds where message should be replayed to, the same way as RabbitMQ does
+func (b *Broker) ResolveDestination(message state.MessageStruct) state.Destination {
+	return b.config.ResolveDestination(message)
+}
+
+// MonitorQueues periodically reports depth of the DLQ and the target queue, until broker is closed
+func (b *Broker) MonitorQueues(listener state.StatsListener) {
+	broker.MonitorQueues(b.config.Monitor.Interval, b.done,
+		broker.Queue{Name: b.config.Dlq, Inspect: b.inspector(b.config.Dlq)},
+		broker.Queue{Name: b.config.Queue, Inspect: b.inspector(b.config.Queue)},
+		listener)
+}
+
+func (b *Broker) inspector(name string) func() (int, int, error) {
+	return func() (int, int, error) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		q, err := b.queue(name)
+		if err != nil {
+			return 0, 0, err
+		}
+		return len(q.messages), 0, nil
+	}
+}
+
+// publish stores a message with its original body, as it's sent over the wire
+func (b *Broker) publish(destination state.Destination, message state.MessageStruct) error {
+	if b.config.DryRun {
+		b.RecordDryRun(state.DryRunOperation{
+			Operation:  "publish",
+			Exchange:   destination.Exchange,
+			RoutingKey: destination.RoutingKey,
+			MessageId:  message.Properties.MessageId,
+		})
+		return nil
+	}
+
+	body, err := compression.Body(message)
+	if err != nil {
+		return err
+	}
+	published := state.MessageStruct{
+		Body:       string(body),
+		Headers:    message.Headers,
+		Properties: message.Properties,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.deliver(destination.Exchange, destination.RoutingKey, published, false)
+}
+
+// queue returns an existing queue. Should be called under lock
+func (b *Broker) queue(name string) (*queue, error) {
+	q, ok := b.queues[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrQueueNotFound, name)
+	}
+	return q, nil
+}
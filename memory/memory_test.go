@@ -0,0 +1,270 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/streadway/amqp"
+
+	"DeadRabbit/broker"
+	"DeadRabbit/rabbitmq"
+	"DeadRabbit/replay"
+	"DeadRabbit/state"
+)
+
+const testFixture = `
+dlq: "orders.dlq"
+queue: "orders"
+queues:
+  - name: "orders"
+  - name: "invoices"
+    reject: true
+  - name: "parking-lot"
+bindings:
+  - exchange: "orders-exchange"
+    routingKey: "order.created"
+    queue: "orders"
+  - exchange: "orders-exchange"
+    routingKey: "invoice.requested"
+    queue: "invoices"
+messages:
+  - body: "order"
+    properties:
+      messageId: "order-1"
+  - queue: "invoices"
+    exchange: "orders-exchange"
+    routingKey: "invoice.requested"
+    deaths: 2
+    body: "invoice"
+    properties:
+      messageId: "invoice-1"
+`
+
+func newTestBroker(t *testing.T, rc rabbitmq.Configuration) *Broker {
+	t.Helper()
+	fixture, err := ParseFixture([]byte(testFixture))
+	if err != nil {
+		t.Fatalf("ParseFixture() error = %v", err)
+	}
+	rc.Monitor.Interval = -1
+	b := New(fixture, rc, func(state.ConnectionStatus, error) {})
+	t.Cleanup(b.Close)
+	return b
+}
+
+func load(t *testing.T, b *Broker) []state.MessageStruct {
+	t.Helper()
+	loaded := make([]state.MessageStruct, 0)
+	if err := b.LoadMessages(context.Background(), func(messages []state.MessageStruct) {
+		loaded = append(loaded, messages...)
+	}); err != nil {
+		t.Fatalf("LoadMessages() error = %v", err)
+	}
+	return loaded
+}
+
+// queued returns messages, which are ready in the queue
+func queued(t *testing.T, b *Broker, name string) []state.MessageStruct {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	q, err := b.queue(name)
+	if err != nil {
+		t.Fatalf("queue(%s) error = %v", name, err)
+	}
+	return append([]state.MessageStruct{}, q.messages...)
+}
+
+func assertIds(t *testing.T, messages []state.MessageStruct, want ...string) {
+	t.Helper()
+	got := make([]string, 0, len(messages))
+	for _, m := range messages {
+		got = append(got, m.Properties.MessageId)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got messages %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("got messages %v, want %v", got, want)
+		}
+	}
+}
+
+// deathCount returns count of the latest x-death entry
+func deathCount(t *testing.T, message state.MessageStruct) int64 {
+	t.Helper()
+	deaths, _ := message.Headers["x-death"].([]any)
+	if len(deaths) == 0 {
+		t.Fatalf("message %s has no x-death header", message.Properties.MessageId)
+	}
+	count, _ := deaths[0].(amqp.Table)["count"].(int64)
+	return count
+}
+
+func TestLoadTakesMessagesOfDlq(t *testing.T) {
+	b := newTestBroker(t, rabbitmq.Configuration{})
+
+	loaded := load(t, b)
+
+	assertIds(t, loaded, "order-1", "invoice-1")
+	if loaded[0].DeliveryTag == 0 || loaded[1].DeliveryTag == 0 {
+		t.Errorf("messages, loaded in a browse mode, should have delivery tags")
+	}
+	if want := (state.Destination{RoutingKey: "orders"}); loaded[0].Destination != want {
+		t.Errorf("destination = %+v, want %+v", loaded[0].Destination, want)
+	}
+	if count := deathCount(t, loaded[1]); count != 2 {
+		t.Errorf("x-death count = %d, want 2", count)
+	}
+	if count, _ := b.CountMessages(); count != 0 {
+		t.Errorf("CountMessages() = %d, want 0 for loaded messages", count)
+	}
+}
+
+func TestRequeueDeliversToDestination(t *testing.T) {
+	b := newTestBroker(t, rabbitmq.Configuration{})
+	loaded := load(t, b)
+
+	if err := b.RequeueMessage(loaded[0]); err != nil {
+		t.Fatalf("RequeueMessage() error = %v", err)
+	}
+
+	requeued := queued(t, b, "orders")
+	assertIds(t, requeued, "order-1")
+	if count := replay.Count(requeued[0].Headers); count != 1 {
+		t.Errorf("replay count = %d, want 1", count)
+	}
+	// Requeued message is acknowledged, so only the other one is returned on release
+	if err := b.ReleaseMessages(loaded); err != nil {
+		t.Fatalf("ReleaseMessages() error = %v", err)
+	}
+	assertIds(t, queued(t, b, "orders.dlq"), "invoice-1")
+}
+
+func TestRequeueToRejectingQueueDeadLettersAgain(t *testing.T) {
+	b := newTestBroker(t, rabbitmq.Configuration{ReplayTarget: rabbitmq.ReplayToOriginExchange})
+	loaded := load(t, b)
+	if want := (state.Destination{Exchange: "orders-exchange", RoutingKey: "invoice.requested"}); loaded[1].Destination != want {
+		t.Fatalf("destination = %+v, want %+v", loaded[1].Destination, want)
+	}
+
+	if err := b.RequeueMessage(loaded[1]); err != nil {
+		t.Fatalf("RequeueMessage() error = %v", err)
+	}
+
+	reloaded := load(t, b)
+	assertIds(t, reloaded, "invoice-1")
+	if count := deathCount(t, reloaded[0]); count != 3 {
+		t.Errorf("x-death count = %d, want 3", count)
+	}
+	if reloaded[0].ReplayCount != 1 {
+		t.Errorf("replay count = %d, want 1", reloaded[0].ReplayCount)
+	}
+}
+
+func TestRequeueIsRefusedOnReplayLimit(t *testing.T) {
+	b := newTestBroker(t, rabbitmq.Configuration{MaxReplays: 1})
+	loaded := load(t, b)
+	loaded[0].ReplayCount = 1
+
+	if err := b.RequeueMessage(loaded[0]); !errors.Is(err, replay.ErrLimitReached) {
+		t.Errorf("RequeueMessage() error = %v, want %v", err, replay.ErrLimitReached)
+	}
+	if len(queued(t, b, "orders")) != 0 {
+		t.Errorf("message shouldn't be requeued")
+	}
+}
+
+func TestMoveMarksWhereMessageIsMovedFrom(t *testing.T) {
+	b := newTestBroker(t, rabbitmq.Configuration{})
+	loaded := load(t, b)
+
+	if err := b.MoveMessage(loaded[0], state.Destination{RoutingKey: "parking-lot"}); err != nil {
+		t.Fatalf("MoveMessage() error = %v", err)
+	}
+	moved := queued(t, b, "parking-lot")
+	assertIds(t, moved, "order-1")
+	if from := moved[0].Headers[broker.MovedFromHeader]; from != "orders.dlq" {
+		t.Errorf("moved from = %v, want orders.dlq", from)
+	}
+
+	err := b.MoveMessage(loaded[1], state.Destination{Exchange: "orders-exchange", RoutingKey: "unknown"})
+	if !errors.Is(err, rabbitmq.ErrNotRoutable) {
+		t.Errorf("MoveMessage() error = %v, want %v", err, rabbitmq.ErrNotRoutable)
+	}
+}
+
+func TestDropRemovesMessageForGood(t *testing.T) {
+	b := newTestBroker(t, rabbitmq.Configuration{})
+	loaded := load(t, b)
+
+	if err := b.AckMessage(loaded[0]); err != nil {
+		t.Fatalf("AckMessage() error = %v", err)
+	}
+	if err := b.AckMessage(loaded[0]); err == nil {
+		t.Errorf("AckMessage() of an acknowledged message should fail")
+	}
+	if err := b.ReleaseMessages(loaded); err != nil {
+		t.Fatalf("ReleaseMessages() error = %v", err)
+	}
+	assertIds(t, queued(t, b, "orders.dlq"), "invoice-1")
+}
+
+func TestReleaseKeepsOrderOfMessages(t *testing.T) {
+	b := newTestBroker(t, rabbitmq.Configuration{PageSize: 1})
+	first := load(t, b)
+	second := load(t, b)
+	assertIds(t, append(first, second...), "order-1", "invoice-1")
+
+	if err := b.ReleaseMessages(append(first, second...)); err != nil {
+		t.Fatalf("ReleaseMessages() error = %v", err)
+	}
+	assertIds(t, queued(t, b, "orders.dlq"), "order-1", "invoice-1")
+}
+
+func TestDrainModeReleasesByRepublishing(t *testing.T) {
+	b := newTestBroker(t, rabbitmq.Configuration{Mode: rabbitmq.DrainMode})
+	loaded := load(t, b)
+	if loaded[0].DeliveryTag != 0 {
+		t.Errorf("drained message shouldn't have a delivery tag")
+	}
+	if count, _ := b.CountMessages(); count != 0 {
+		t.Errorf("CountMessages() = %d, want 0", count)
+	}
+
+	if err := b.ReleaseMessages(loaded[1:]); err != nil {
+		t.Fatalf("ReleaseMessages() error = %v", err)
+	}
+	assertIds(t, queued(t, b, "orders.dlq"), "invoice-1")
+}
+
+func TestRestorePublishesToDlq(t *testing.T) {
+	b := newTestBroker(t, rabbitmq.Configuration{})
+	restored := state.MessageStruct{Body: "restored", Properties: state.MessageProperties{MessageId: "restored-1"}}
+
+	if err := b.RestoreMessages([]state.MessageStruct{restored}); err != nil {
+		t.Fatalf("RestoreMessages() error = %v", err)
+	}
+	assertIds(t, queued(t, b, "orders.dlq"), "order-1", "invoice-1", "restored-1")
+}
+
+func TestDryRunChangesNothing(t *testing.T) {
+	b := newTestBroker(t, rabbitmq.Configuration{Mode: rabbitmq.DrainMode, DryRun: true})
+	loaded := load(t, b)
+
+	if err := b.RequeueMessage(loaded[0]); err != nil {
+		t.Fatalf("RequeueMessage() error = %v", err)
+	}
+	if len(queued(t, b, "orders")) != 0 {
+		t.Errorf("message shouldn't be requeued in a dry run")
+	}
+	if len(b.DryRunOperations()) != 2 {
+		t.Errorf("DryRunOperations() = %+v, want publish and ack", b.DryRunOperations())
+	}
+	if err := b.ReleaseMessages(loaded); err != nil {
+		t.Fatalf("ReleaseMessages() error = %v", err)
+	}
+	assertIds(t, queued(t, b, "orders.dlq"), "order-1", "invoice-1")
+}
@@ -0,0 +1,223 @@
+package rabbitmq
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/streadway/amqp"
+
+	"DeadRabbit/broker"
+	"DeadRabbit/replay"
+	"DeadRabbit/state"
+)
+
+var ErrNotConnected = errors.New("not connected to RabbitMQ")
+
+// Connection is a long-living connection to RabbitMQ, shared by all operations.
+// It watches for connection/channel closing and reconnects with exponential backoff.
+type Connection struct {
+	replay.Limit
+	broker.DryRunRecorder
+
+	config     Configuration
+	supervisor *broker.Supervisor
+
+	mu         sync.Mutex
+	connection *amqp.Connection
+	channel    *amqp.Channel
+	// browseChannel holds loaded, but not yet acknowledged messages in a browse mode.
+	// Closing it returns all of them back to the queue.
+	browseChannel *amqp.Channel
+
+	// Shared channel is in a confirm mode; publishings are serialized, so there is at most one not confirmed
+	publishMu  sync.Mutex
+	publishSeq uint64
+	confirms   chan amqp.Confirmation
+	returns    chan amqp.Return
+}
+
+func Connect(c Configuration, listener state.StatusListener) *Connection {
+	conn := &Connection{
+		Limit:          replay.Limit{Max: c.MaxReplays, OnLimit: c.OnReplayLimit},
+		DryRunRecorder: broker.DryRunRecorder{Dlq: c.Dlq},
+		config:         c,
+	}
+	conn.supervisor = broker.NewSupervisor(broker.SupervisorConfiguration{
+		Name:            "RabbitMQ",
+		Attempts:        c.ReconnectAttempts,
+		ErrNotConnected: ErrNotConnected,
+	}, conn.connect, listener)
+
+	go conn.supervisor.Run()
+
+	return conn
+}
+
+func (c *Connection) Close() {
+	c.supervisor.Close()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closeAmqp()
+}
+
+// connect opens connection and channels; once any of them is closed, all of them are closed and connection is lost
+func (c *Connection) connect() (<-chan error, error) {
+	closed, err := c.open()
+	if err != nil {
+		return nil, err
+	}
+
+	lost := make(chan error, 1)
+	go func() {
+		amqpErr := <-closed
+		c.mu.Lock()
+		c.closeAmqp()
+		c.mu.Unlock()
+
+		if amqpErr != nil {
+			lost <- amqpErr
+		} else {
+			lost <- nil
+		}
+	}()
+	return lost, nil
+}
+
+// open establishes connection and channel and returns a channel, which receives an error,
+// when any of them is closed
+func (c *Connection) open() (<-chan *amqp.Error, error) {
+	connection, err := c.config.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	channel, err := connection.Channel()
+	if err != nil {
+		_ = connection.Close()
+		return nil, err
+	}
+
+	if err = channel.Confirm(false); err != nil {
+		_ = connection.Close()
+		return nil, err
+	}
+	confirms := channel.NotifyPublish(make(chan amqp.Confirmation, 10))
+	returns := channel.NotifyReturn(make(chan amqp.Return, 10))
+
+	closed := make(chan *amqp.Error, 3)
+	connection.NotifyClose(forwardClose(closed))
+	channel.NotifyClose(forwardClose(closed))
+
+	var browseChannel *amqp.Channel
+	if c.IsBrowsing() {
+		browseChannel, err = connection.Channel()
+		if err != nil {
+			_ = connection.Close()
+			return nil, err
+		}
+		browseChannel.NotifyClose(forwardClose(closed))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connection = connection
+	c.channel = channel
+	c.browseChannel = browseChannel
+	c.confirms = confirms
+	c.returns = returns
+	c.publishSeq = 0
+
+	return closed, nil
+}
+
+func (c *Connection) closeAmqp() {
+	if c.browseChannel != nil {
+		if err := c.browseChannel.Close(); err != nil && err != amqp.ErrClosed {
+			log.Printf("Can't close a browse channel, err is %v", err)
+		}
+		c.browseChannel = nil
+	}
+	if c.channel != nil {
+		if err := c.channel.Close(); err != nil && err != amqp.ErrClosed {
+			log.Printf("Can't close a channel, err is %v", err)
+		}
+		c.channel = nil
+	}
+	if c.connection != nil {
+		if err := c.connection.Close(); err != nil && err != amqp.ErrClosed {
+			log.Printf("Can't close a connection, err is %v", err)
+		}
+		c.connection = nil
+	}
+}
+
+// getChannel returns a shared channel, if connection is established.
+// If reconnecting has failed, it triggers another round of reconnection attempts.
+func (c *Connection) getChannel() (*amqp.Channel, error) {
+	if err := c.supervisor.EnsureConnected(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.channel == nil {
+		return nil, fmt.Errorf("%w (channel is closed)", ErrNotConnected)
+	}
+	return c.channel, nil
+}
+
+// getPublisher returns a shared channel along with its confirmations and returns, and a sequence number,
+// which the next publishing on this channel will be confirmed with
+func (c *Connection) getPublisher() (*amqp.Channel, <-chan amqp.Confirmation, <-chan amqp.Return, uint64, error) {
+	channel, err := c.getChannel()
+	if err != nil {
+		return nil, nil, nil, 0, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.publishSeq++
+	return channel, c.confirms, c.returns, c.publishSeq, nil
+}
+
+func (c *Connection) getBrowseChannel() (*amqp.Channel, error) {
+	if _, err := c.getChannel(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.browseChannel == nil {
+		return nil, fmt.Errorf("%w (browse channel is closed)", ErrNotConnected)
+	}
+	return c.browseChannel, nil
+}
+
+// IsBrowsing tells whether loaded messages are still owned by the broker, i.e. they are held unacknowledged
+// and will be returned to the queue automatically, if connection is lost. Dry run always browses, as draining
+// would take messages off the broker.
+func (c *Connection) IsBrowsing() bool {
+	return c.config.Mode != DrainMode || c.config.DryRun
+}
+
+// ResolveDestination finds where message should be replayed to, according to the configured replay target
+func (c *Connection) ResolveDestination(message state.MessageStruct) state.Destination {
+	return c.config.ResolveDestination(message)
+}
+
+// forwardClose fans a single close notification into a shared channel
+func forwardClose(to chan<- *amqp.Error) chan *amqp.Error {
+	from := make(chan *amqp.Error, 1)
+	go func() {
+		err, ok := <-from
+		if ok {
+			to <- err
+		} else {
+			to <- nil
+		}
+	}()
+	return from
+}
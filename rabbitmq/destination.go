@@ -0,0 +1,86 @@
+package rabbitmq
+
+import (
+	"github.com/streadway/amqp"
+
+	"DeadRabbit/state"
+)
+
+const (
+	// ReplayToQueue publishes messages to the configured Queue
+	ReplayToQueue = "queue"
+	// ReplayToOriginQueue publishes messages directly to the queue, they were dead-lettered from
+	ReplayToOriginQueue = "origin-queue"
+	// ReplayToOriginExchange publishes messages to the exchange and routing key, they were originally published with
+	ReplayToOriginExchange = "origin-exchange"
+)
+
+// NamedDestination is a configured place, messages could be moved to, e.g. parking-lot queue or an archive exchange
+type NamedDestination struct {
+	Name       string
+	Exchange   string
+	RoutingKey string `yaml:"routingKey"`
+}
+
+func (d NamedDestination) Destination() state.Destination {
+	return state.Destination{Exchange: d.Exchange, RoutingKey: d.RoutingKey}
+}
+
+// ResolveDestination finds where message should be replayed to, according to the configured replay target.
+// If origin can't be resolved from the death headers, configured Queue is used as a fallback.
+func (c Configuration) ResolveDestination(message state.MessageStruct) state.Destination {
+	fallback := state.Destination{RoutingKey: c.Queue}
+
+	switch c.ReplayTarget {
+	case ReplayToOriginQueue:
+		if queue, _, _, ok := c.findDeath(message.Headers); ok && queue != "" {
+			return state.Destination{RoutingKey: queue}
+		}
+	case ReplayToOriginExchange:
+		if queue, exchange, routingKeys, ok := c.findDeath(message.Headers); ok {
+			if len(routingKeys) > 0 {
+				return state.Destination{Exchange: exchange, RoutingKey: routingKeys[0]}
+			}
+			if exchange == "" && queue != "" {
+				return state.Destination{RoutingKey: queue}
+			}
+		}
+	}
+
+	return fallback
+}
+
+// findDeath looks for the most recent dead-lettering, which has happened not in the DLQ itself.
+// It reads "x-death" header first and falls back to "x-first-death-*" headers.
+func (c Configuration) findDeath(headers map[string]any) (queue, exchange string, routingKeys []string, ok bool) {
+	if deaths, isList := headers["x-death"].([]any); isList {
+		for _, d := range deaths {
+			death, isTable := d.(amqp.Table)
+			if !isTable {
+				continue
+			}
+			queue, _ = death["queue"].(string)
+			if queue == c.Dlq {
+				continue
+			}
+			exchange, _ = death["exchange"].(string)
+			routingKeys = make([]string, 0)
+			if keys, isList := death["routing-keys"].([]any); isList {
+				for _, key := range keys {
+					if key, isString := key.(string); isString {
+						routingKeys = append(routingKeys, key)
+					}
+				}
+			}
+			return queue, exchange, routingKeys, true
+		}
+	}
+
+	queue, hasQueue := headers["x-first-death-queue"].(string)
+	exchange, hasExchange := headers["x-first-death-exchange"].(string)
+	if hasQueue || hasExchange {
+		return queue, exchange, nil, true
+	}
+
+	return "", "", nil, false
+}
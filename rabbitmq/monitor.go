@@ -0,0 +1,55 @@
+package rabbitmq
+
+import (
+	"DeadRabbit/broker"
+	"DeadRabbit/state"
+)
+
+type MonitorConfiguration struct {
+	// Interval is how often queues are inspected, in seconds; Negative value disables monitoring
+	Interval int
+	// Alert notifies about new messages, which have arrived to the DLQ
+	Alert bool
+}
+
+// MonitorQueues periodically inspects the DLQ and the target queue, until connection is closed.
+// Queues are inspected on a short-living channel, so a missing queue doesn't break the shared one.
+func (c *Connection) MonitorQueues(listener state.StatsListener) {
+	broker.MonitorQueues(c.config.Monitor.Interval, c.supervisor.Done(),
+		broker.Queue{Name: c.config.Dlq, Inspect: c.inspector(c.config.Dlq)},
+		broker.Queue{Name: c.config.Queue, Inspect: c.inspector(c.config.Queue)},
+		listener)
+}
+
+func (c *Connection) inspector(name string) func() (int, int, error) {
+	return func() (int, int, error) {
+		return c.inspectQueue(name)
+	}
+}
+
+// inspectQueue returns number of ready messages and consumers of the queue
+func (c *Connection) inspectQueue(name string) (int, int, error) {
+	if _, err := c.getChannel(); err != nil {
+		return 0, 0, err
+	}
+
+	c.mu.Lock()
+	connection := c.connection
+	c.mu.Unlock()
+	if connection == nil {
+		return 0, 0, ErrNotConnected
+	}
+
+	// Inspecting missing queue closes the channel, so it's a separate one
+	channel, err := connection.Channel()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer channel.Close()
+
+	queue, err := channel.QueueInspect(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	return queue.Messages, queue.Consumers, nil
+}
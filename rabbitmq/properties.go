@@ -0,0 +1,147 @@
+package rabbitmq
+
+import (
+	"time"
+
+	"github.com/streadway/amqp"
+
+	"DeadRabbit/compression"
+	"DeadRabbit/replay"
+	"DeadRabbit/state"
+)
+
+// PropertiesOverrides describes message properties, which should be replaced on replay.
+// Only explicitly specified properties are overridden, all others are republished as they were received.
+type PropertiesOverrides struct {
+	ContentType     *string    `yaml:"contentType"`
+	ContentEncoding *string    `yaml:"contentEncoding"`
+	DeliveryMode    *uint8     `yaml:"deliveryMode"`
+	Priority        *uint8     `yaml:"priority"`
+	CorrelationId   *string    `yaml:"correlationId"`
+	ReplyTo         *string    `yaml:"replyTo"`
+	Expiration      *string    `yaml:"expiration"`
+	MessageId       *string    `yaml:"messageId"`
+	Timestamp       *time.Time `yaml:"timestamp"`
+	Type            *string    `yaml:"type"`
+	AppId           *string    `yaml:"appId"`
+}
+
+// Apply replaces specified properties
+func (o PropertiesOverrides) Apply(p state.MessageProperties) state.MessageProperties {
+	if o.ContentType != nil {
+		p.ContentType = *o.ContentType
+	}
+	if o.ContentEncoding != nil {
+		p.ContentEncoding = *o.ContentEncoding
+	}
+	if o.DeliveryMode != nil {
+		p.DeliveryMode = *o.DeliveryMode
+	}
+	if o.Priority != nil {
+		p.Priority = *o.Priority
+	}
+	if o.CorrelationId != nil {
+		p.CorrelationId = *o.CorrelationId
+	}
+	if o.ReplyTo != nil {
+		p.ReplyTo = *o.ReplyTo
+	}
+	if o.Expiration != nil {
+		p.Expiration = *o.Expiration
+	}
+	if o.MessageId != nil {
+		p.MessageId = *o.MessageId
+	}
+	if o.Timestamp != nil {
+		p.Timestamp = *o.Timestamp
+	}
+	if o.Type != nil {
+		p.Type = *o.Type
+	}
+	if o.AppId != nil {
+		p.AppId = *o.AppId
+	}
+	return p
+}
+
+func toMessage(d amqp.Delivery) state.MessageStruct {
+	return state.MessageStruct{
+		Body:        string(d.Body),
+		Headers:     d.Headers,
+		ReplayCount: replay.Count(d.Headers),
+		Properties: state.MessageProperties{
+			ContentType:     d.ContentType,
+			ContentEncoding: d.ContentEncoding,
+			DeliveryMode:    d.DeliveryMode,
+			Priority:        d.Priority,
+			CorrelationId:   d.CorrelationId,
+			ReplyTo:         d.ReplyTo,
+			Expiration:      d.Expiration,
+			MessageId:       d.MessageId,
+			Timestamp:       d.Timestamp,
+			Type:            d.Type,
+			UserId:          d.UserId,
+			AppId:           d.AppId,
+		},
+	}
+}
+
+func (c *Connection) toPublishing(message state.MessageStruct, properties state.MessageProperties) (amqp.Publishing, error) {
+	body, err := compression.Body(message)
+	if err != nil {
+		return amqp.Publishing{}, err
+	}
+
+	publishing := amqp.Publishing{
+		Headers:         toTable(message.Headers),
+		ContentType:     properties.ContentType,
+		ContentEncoding: properties.ContentEncoding,
+		DeliveryMode:    properties.DeliveryMode,
+		Priority:        properties.Priority,
+		CorrelationId:   properties.CorrelationId,
+		ReplyTo:         properties.ReplyTo,
+		Expiration:      properties.Expiration,
+		MessageId:       properties.MessageId,
+		Timestamp:       properties.Timestamp,
+		Type:            properties.Type,
+		AppId:           properties.AppId,
+		Body:            body,
+	}
+
+	// Broker rejects messages with user-id, which doesn't match the connected user
+	if properties.UserId == c.config.User {
+		publishing.UserId = properties.UserId
+	}
+
+	return publishing, nil
+}
+
+// toTable converts headers, including nested ones (e.g. edited by user), into AMQP table
+func toTable(headers map[string]any) amqp.Table {
+	if headers == nil {
+		return nil
+	}
+
+	table := make(amqp.Table, len(headers))
+	for key, value := range headers {
+		table[key] = toFieldValue(value)
+	}
+	return table
+}
+
+func toFieldValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		return toTable(v)
+	case amqp.Table:
+		return toTable(v)
+	case []any:
+		result := make([]any, 0, len(v))
+		for _, item := range v {
+			result = append(result, toFieldValue(item))
+		}
+		return result
+	default:
+		return v
+	}
+}
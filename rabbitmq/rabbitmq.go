@@ -1,106 +1,225 @@
 package rabbitmq
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/streadway/amqp"
 
+	"DeadRabbit/broker"
+	"DeadRabbit/compression"
+	"DeadRabbit/replay"
 	"DeadRabbit/state"
 )
 
+const (
+	// BrowseMode keeps loaded messages unacknowledged, so broker keeps ownership of them
+	BrowseMode = "browse"
+	// DrainMode takes messages out of DLQ and republishes untouched ones back on reload/exit
+	DrainMode = "drain"
+)
+
+const (
+	confirmTimeout  = 10 * time.Second
+	defaultPageSize = 200
+	loadBatchSize   = 50
+)
+
+var (
+	ErrNotRoutable  = errors.New("message can't be routed")
+	ErrNotConfirmed = errors.New("broker has rejected message")
+)
+
 type Configuration struct {
 	User     string
 	Password string
 	Host     string
 	Port     string
 	Vhost    string
-	Queue    string
-	Dlq      string
+	// Auth is either PlainAuth (default) or ExternalAuth
+	Auth  string
+	Tls   TlsConfiguration
+	Queue string
+	Dlq   string
+	// Mode is either BrowseMode (default) or DrainMode
+	Mode string
+	// ReplayTarget is one of ReplayToQueue (default), ReplayToOriginQueue or ReplayToOriginExchange
+	ReplayTarget      string `yaml:"replayTarget"`
+	ReconnectAttempts int    `yaml:"reconnectAttempts"`
+	// PageSize is how many messages are loaded at once
+	PageSize int `yaml:"pageSize"`
+	// Destinations are places, messages could be moved to
+	Destinations []NamedDestination
+	// OverrideProperties are applied to replayed messages
+	OverrideProperties PropertiesOverrides `yaml:"overrideProperties"`
+	// MaxReplays limits how many times the same message could be replayed; zero means unlimited
+	MaxReplays int `yaml:"maxReplays"`
+	// OnReplayLimit is either replay.RefuseOnLimit (default) or replay.WarnOnLimit
+	OnReplayLimit string `yaml:"onReplayLimit"`
+	// Operator is stamped into replayed messages; "user@host" by default
+	Operator string
+	// DryRun logs mutating operations instead of sending them to the broker
+	DryRun bool `yaml:"-"`
+	// Monitor polls DLQ and target queue depth in background
+	Monitor MonitorConfiguration
 }
 
-func LoadMessages(c Configuration) ([]state.MessageStruct, error) {
-	connectionString := fmt.Sprintf("amqp://%s:%s@%s:%s/%s",
-		c.User,
-		c.Password,
-		c.Host,
-		c.Port,
-		c.Vhost)
-
-	connection, err := amqp.Dial(connectionString)
+// LoadMessages takes the next page of messages from the DLQ. Messages are passed to onLoaded in small batches,
+// as soon as they're taken, so loading could be cancelled without losing already taken messages.
+func (c *Connection) LoadMessages(ctx context.Context, onLoaded func([]state.MessageStruct)) error {
+	var channel *amqp.Channel
+	var err error
+	if c.IsBrowsing() {
+		channel, err = c.getBrowseChannel()
+	} else {
+		channel, err = c.getChannel()
+	}
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer func(connection *amqp.Connection) {
-		err := connection.Close()
-		if err != nil {
-			log.Printf("Can't close a connection, err is %v", err)
+
+	batch := make([]state.MessageStruct, 0, loadBatchSize)
+	for loaded := 0; loaded < c.PageSize(); loaded++ {
+		if ctx.Err() != nil {
+			break
 		}
-	}(connection)
 
-	channel, err := connection.Channel()
-	if err != nil {
-		return nil, err
-	}
-	defer func(channel *amqp.Channel) {
-		err := channel.Close()
+		msg, ok, err := channel.Get(c.config.Dlq, !c.IsBrowsing())
 		if err != nil {
-			log.Printf("Can't close a channel, err is %v", err)
+			if c.IsBrowsing() {
+				// Channel is broken, so taken messages are returned to the DLQ by broker already
+				return err
+			}
+			onLoaded(batch)
+			return err
 		}
-	}(channel)
-
-	messages := make([]state.MessageStruct, 0, 10)
-
-	for {
-		if msg, ok, _ := channel.Get(c.Dlq, true); !ok {
+		if !ok {
 			break
-		} else {
-			messages = append(messages, state.MessageStruct{
-				Body:    string(msg.Body),
-				Headers: msg.Headers,
-			})
+		}
+		message, err := compression.Decompress(toMessage(msg))
+		if err != nil {
+			// Body is kept as it was received, so it's published back untouched
+			log.Printf("Can't decompress message, err: %s", err.Error())
+			message.Error = err.Error()
+		}
+		message.Destination = c.ResolveDestination(message)
+		if c.IsBrowsing() {
+			message.DeliveryTag = msg.DeliveryTag
+		}
+		batch = append(batch, message)
+
+		if len(batch) == loadBatchSize {
+			onLoaded(batch)
+			batch = make([]state.MessageStruct, 0, loadBatchSize)
 		}
 	}
 
-	return messages, nil
+	if len(batch) > 0 {
+		onLoaded(batch)
+	}
+	return ctx.Err()
+}
+
+// CountMessages returns number of messages in the DLQ, which are ready to be loaded
+func (c *Connection) CountMessages() (int, error) {
+	messages, _, err := c.inspectQueue(c.config.Dlq)
+	return messages, err
 }
 
-func PublishMessagesToDlq(messages []state.MessageStruct, c Configuration) error {
-	connectionString := fmt.Sprintf("amqp://%s:%s@%s:%s/%s",
-		c.User,
-		c.Password,
-		c.Host,
-		c.Port,
-		c.Vhost)
+func (c *Connection) PageSize() int {
+	if c.config.PageSize <= 0 {
+		return defaultPageSize
+	}
+	return c.config.PageSize
+}
 
-	connection, err := amqp.Dial(connectionString)
+// ReleaseMessages gives loaded messages back to the DLQ: in a browse mode they are just negatively acknowledged,
+// so broker puts them back on their original positions; in a drain mode they are republished to the DLQ.
+func (c *Connection) ReleaseMessages(messages []state.MessageStruct) error {
+	if !c.IsBrowsing() {
+		return c.publishMessagesToDlq(messages)
+	}
+
+	channel, err := c.getBrowseChannel()
 	if err != nil {
 		return err
 	}
-	defer func(connection *amqp.Connection) {
-		err := connection.Close()
-		if err != nil {
-			log.Printf("Can't close a connection, err is %v", err)
-		}
-	}(connection)
 
-	channel, err := connection.Channel()
+	// Zero delivery tag with multiple flag means "all outstanding messages"
+	return channel.Nack(0, true, true)
+}
+
+// AckMessage removes a loaded message from the DLQ for good
+func (c *Connection) AckMessage(message state.MessageStruct) error {
+	if message.DeliveryTag == 0 {
+		// Message was drained, so it's not in the DLQ already
+		return nil
+	}
+	if c.config.DryRun {
+		c.RecordDryRun(state.DryRunOperation{
+			Operation:   "ack",
+			MessageId:   message.Properties.MessageId,
+			DeliveryTag: message.DeliveryTag,
+		})
+		return nil
+	}
+
+	channel, err := c.getBrowseChannel()
 	if err != nil {
 		return err
 	}
-	defer func(channel *amqp.Channel) {
-		err := channel.Close()
-		if err != nil {
-			log.Printf("Can't close a channel, err is %v", err)
-		}
-	}(channel)
 
+	return channel.Ack(message.DeliveryTag, false)
+}
+
+// RequeueMessage publishes a message to its destination, stamped with replay headers, and removes it from the DLQ
+func (c *Connection) RequeueMessage(message state.MessageStruct) error {
+	if err := c.Limit.Check(message); err != nil {
+		return err
+	}
+	message.Headers = replay.Stamp(message, c.config.Operator)
+	if err := c.publishMessage(message, message.Destination); err != nil {
+		return err
+	}
+
+	return c.AckMessage(message)
+}
+
+// MoveMessage publishes a message as is to the given destination, marking where it was moved from,
+// and removes it from the DLQ
+func (c *Connection) MoveMessage(message state.MessageStruct, destination state.Destination) error {
+	message.Headers = broker.MarkMovedFrom(message.Headers, c.config.Dlq)
+
+	publishing, err := c.toPublishing(message, message.Properties)
+	if err != nil {
+		return err
+	}
+	if err := c.publish(destination.Exchange, destination.RoutingKey, publishing); err != nil {
+		return err
+	}
+
+	return c.AckMessage(message)
+}
+
+// RestoreMessages publishes messages back to the DLQ as they are, e.g. ones, which were taken by an interrupted session
+func (c *Connection) RestoreMessages(messages []state.MessageStruct) error {
+	return c.publishMessagesToDlq(messages)
+}
+
+func (c *Connection) Destinations() []NamedDestination {
+	return c.config.Destinations
+}
+
+func (c *Connection) publishMessagesToDlq(messages []state.MessageStruct) error {
 	for _, message := range messages {
-		if err := channel.Publish("", c.Dlq, true, false, amqp.Publishing{
-			Headers:     message.Headers,
-			ContentType: "application/json",
-			Body:        []byte(message.Body),
-		}); err != nil {
+		publishing, err := c.toPublishing(message, message.Properties)
+		if err != nil {
+			return err
+		}
+		if err := c.publish("", c.config.Dlq, publishing); err != nil {
 			return err
 		}
 	}
@@ -108,39 +227,73 @@ func PublishMessagesToDlq(messages []state.MessageStruct, c Configuration) error
 	return nil
 }
 
-func PublishMessageToQueue(message state.MessageStruct, c Configuration) error {
-	connectionString := fmt.Sprintf("amqp://%s:%s@%s:%s/%s",
-		c.User,
-		c.Password,
-		c.Host,
-		c.Port,
-		c.Vhost)
+func (c *Connection) publishMessage(message state.MessageStruct, destination state.Destination) error {
+	if destination.RoutingKey == "" && destination.Exchange == "" {
+		return fmt.Errorf("can't resolve where to replay the message to")
+	}
 
-	connection, err := amqp.Dial(connectionString)
+	properties := c.config.OverrideProperties.Apply(message.Properties)
+	publishing, err := c.toPublishing(message, properties)
 	if err != nil {
 		return err
 	}
-	defer func(connection *amqp.Connection) {
-		err := connection.Close()
-		if err != nil {
-			log.Printf("Can't close a connection, err is %v", err)
-		}
-	}(connection)
+	return c.publish(destination.Exchange, destination.RoutingKey, publishing)
+}
+
+// publish sends a mandatory message and waits until broker confirms it.
+// Message, which can't be routed to any queue, is reported as an error, even though broker acknowledges it.
+func (c *Connection) publish(exchange, key string, publishing amqp.Publishing) error {
+	if c.config.DryRun {
+		c.RecordDryRun(state.DryRunOperation{
+			Operation:  "publish",
+			Exchange:   exchange,
+			RoutingKey: key,
+			MessageId:  publishing.MessageId,
+		})
+		return nil
+	}
+
+	c.publishMu.Lock()
+	defer c.publishMu.Unlock()
 
-	channel, err := connection.Channel()
+	channel, confirms, returns, seq, err := c.getPublisher()
 	if err != nil {
 		return err
 	}
-	defer func(channel *amqp.Channel) {
-		err := channel.Close()
-		if err != nil {
-			log.Printf("Can't close a channel, err is %v", err)
-		}
-	}(channel)
 
-	return channel.Publish("", c.Queue, true, false, amqp.Publishing{
-		Headers:     message.Headers,
-		ContentType: "application/json",
-		Body:        []byte(message.Body),
-	})
+	// Dropping returns of publishings, which weren't confirmed in time
+	for len(returns) > 0 {
+		<-returns
+	}
+
+	if err := channel.Publish(exchange, key, true, false, publishing); err != nil {
+		return err
+	}
+
+	timeout := time.After(confirmTimeout)
+	for {
+		select {
+		case confirmation, ok := <-confirms:
+			if !ok {
+				return fmt.Errorf("channel was closed before publishing to %s/%s was confirmed", exchange, key)
+			}
+			if confirmation.DeliveryTag < seq {
+				// Late confirmation of a publishing, which has timed out
+				continue
+			}
+			// Broker sends basic.return before basic.ack, so if message was returned, it's already here
+			select {
+			case returned := <-returns:
+				return fmt.Errorf("%w: %s/%s: %d %s",
+					ErrNotRoutable, exchange, key, returned.ReplyCode, returned.ReplyText)
+			default:
+			}
+			if !confirmation.Ack {
+				return fmt.Errorf("%w: %s/%s", ErrNotConfirmed, exchange, key)
+			}
+			return nil
+		case <-timeout:
+			return fmt.Errorf("publishing to %s/%s wasn't confirmed in %s", exchange, key, confirmTimeout)
+		}
+	}
 }
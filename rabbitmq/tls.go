@@ -0,0 +1,109 @@
+package rabbitmq
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+const (
+	// PlainAuth authenticates with user and password
+	PlainAuth = "plain"
+	// ExternalAuth authenticates with a client certificate
+	ExternalAuth = "external"
+)
+
+type TlsConfiguration struct {
+	Enabled            bool
+	CaFile             string `yaml:"caFile"`
+	CertFile           string `yaml:"certFile"`
+	KeyFile            string `yaml:"keyFile"`
+	ServerName         string `yaml:"serverName"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
+}
+
+// externalAuthentication is a SASL EXTERNAL mechanism: broker takes user's identity from the client certificate
+type externalAuthentication struct {
+}
+
+func (a *externalAuthentication) Mechanism() string {
+	return "EXTERNAL"
+}
+
+func (a *externalAuthentication) Response() string {
+	return ""
+}
+
+func (c Configuration) connectionString() string {
+	scheme := "amqp"
+	if c.Tls.Enabled {
+		scheme = "amqps"
+	}
+
+	host := c.Host
+	if c.Port != "" {
+		host = net.JoinHostPort(c.Host, c.Port)
+	}
+
+	userInfo := ""
+	if c.Auth != ExternalAuth {
+		userInfo = url.UserPassword(c.User, c.Password).String() + "@"
+	}
+
+	return fmt.Sprintf("%s://%s%s/%s", scheme, userInfo, host, url.PathEscape(c.Vhost))
+}
+
+func (c Configuration) dial() (*amqp.Connection, error) {
+	config := amqp.Config{
+		Heartbeat: 10 * time.Second,
+		Locale:    "en_US",
+	}
+
+	if c.Auth == ExternalAuth {
+		config.SASL = []amqp.Authentication{&externalAuthentication{}}
+	}
+
+	if c.Tls.Enabled {
+		tlsConfig, err := c.Tls.build()
+		if err != nil {
+			return nil, err
+		}
+		config.TLSClientConfig = tlsConfig
+	}
+
+	return amqp.DialConfig(c.connectionString(), config)
+}
+
+func (t TlsConfiguration) build() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+
+	if t.CaFile != "" {
+		caBundle, err := os.ReadFile(t.CaFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't read CA bundle: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caBundle) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", t.CaFile)
+		}
+	}
+
+	if t.CertFile != "" || t.KeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
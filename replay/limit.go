@@ -0,0 +1,114 @@
+package replay
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"time"
+
+	"DeadRabbit/state"
+)
+
+const (
+	CountHeader      = "x-deadrabbit-replay-count"
+	LastReplayHeader = "x-deadrabbit-last-replay"
+	ReplayedByHeader = "x-deadrabbit-replayed-by"
+)
+
+const (
+	// RefuseOnLimit doesn't replay messages, which have reached the limit
+	RefuseOnLimit = "refuse"
+	// WarnOnLimit asks for a confirmation before replaying such messages
+	WarnOnLimit = "warn"
+)
+
+var ErrLimitReached = errors.New("message has reached replay limit")
+
+// Limit restricts how many times the same message could be replayed. Brokers embed it, so they tell their limits
+type Limit struct {
+	// Max is zero, if replays aren't limited
+	Max int
+	// OnLimit is either RefuseOnLimit (default) or WarnOnLimit
+	OnLimit string
+}
+
+// ReachesReplayLimit tells, whether replaying the message once again exceeds the limit
+func (l Limit) ReachesReplayLimit(message state.MessageStruct) bool {
+	return l.Max > 0 && message.ReplayCount >= l.Max
+}
+
+// WarnsOnReplayLimit tells, whether messages, which have reached the limit, could still be replayed after a warning
+func (l Limit) WarnsOnReplayLimit() bool {
+	return l.OnLimit == WarnOnLimit
+}
+
+// Check returns an error, if the message can't be replayed anymore
+func (l Limit) Check(message state.MessageStruct) error {
+	if l.ReachesReplayLimit(message) && !l.WarnsOnReplayLimit() {
+		return fmt.Errorf("%w: replayed %d times already", ErrLimitReached, message.ReplayCount)
+	}
+	return nil
+}
+
+// Stamp returns a copy of message headers, stamped with replay count, time and operator,
+// so that the next time message is dead-lettered, it's known, that it has already been replayed
+func Stamp(message state.MessageStruct, operator string) map[string]any {
+	headers := make(map[string]any, len(message.Headers)+3)
+	for key, value := range message.Headers {
+		headers[key] = value
+	}
+	headers[CountHeader] = int64(message.ReplayCount + 1)
+	headers[LastReplayHeader] = time.Now()
+	headers[ReplayedByHeader] = Operator(operator)
+	return headers
+}
+
+// Operator identifies who replays messages: configured one or "user@host" by default
+func Operator(configured string) string {
+	if configured != "" {
+		return configured
+	}
+
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return name
+	}
+	return name + "@" + host
+}
+
+// Count reads replay count header, which could be any integer type, depending on who has published a message
+func Count(headers map[string]any) int {
+	switch value := headers[CountHeader].(type) {
+	case int:
+		return value
+	case int8:
+		return int(value)
+	case int16:
+		return int(value)
+	case int32:
+		return int(value)
+	case int64:
+		return int(value)
+	case uint8:
+		return int(value)
+	case uint16:
+		return int(value)
+	case uint32:
+		return int(value)
+	case uint64:
+		return int(value)
+	case float64:
+		return int(value)
+	case string:
+		count, _ := strconv.Atoi(value)
+		return count
+	default:
+		return 0
+	}
+}
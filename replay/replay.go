@@ -0,0 +1,123 @@
+package replay
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"DeadRabbit/state"
+)
+
+const defaultBatchSize = 1
+
+type Configuration struct {
+	// Rate is how many messages are processed per second; zero means unlimited
+	Rate float64
+	// BatchSize is how many messages are processed back to back, before waiting to keep the rate
+	BatchSize int `yaml:"batchSize"`
+}
+
+// Process applies an operation to a single message; message is considered done, only if it returns no error
+type Process func(message state.MessageStruct) error
+
+// Job processes messages one by one in background at a limited rate. It could be paused, resumed and cancelled.
+type Job struct {
+	config Configuration
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	paused bool
+	resume chan struct{}
+}
+
+// Start runs a job over messages. onProcessed is called for every processed message, as soon as its result is known,
+// onFinished is called once, when all messages are processed or job is cancelled.
+func Start(c Configuration, messages []state.MessageStruct, process Process,
+	onProcessed func(state.BulkResult), onFinished func()) *Job {
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &Job{
+		config: c,
+		cancel: cancel,
+		resume: make(chan struct{}),
+	}
+
+	go func() {
+		defer onFinished()
+		j.run(ctx, messages, process, onProcessed)
+	}()
+
+	return j
+}
+
+func (j *Job) run(ctx context.Context, messages []state.MessageStruct, process Process, onProcessed func(state.BulkResult)) {
+	batchSize := j.config.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	for start := 0; start < len(messages); start += batchSize {
+		batchStarted := time.Now()
+		end := start + batchSize
+		if end > len(messages) {
+			end = len(messages)
+		}
+
+		for _, message := range messages[start:end] {
+			if !j.waitIfPaused(ctx) {
+				return
+			}
+			onProcessed(state.BulkResult{MessageId: message.Id, Error: process(message)})
+		}
+
+		if j.config.Rate <= 0 || end == len(messages) {
+			continue
+		}
+		// Batch should take at least as long, as the rate allows
+		wait := time.Duration(float64(end-start)/j.config.Rate*float64(time.Second)) - time.Since(batchStarted)
+		if wait <= 0 {
+			continue
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// waitIfPaused blocks, while job is paused. Returns false, if job was cancelled.
+func (j *Job) waitIfPaused(ctx context.Context) bool {
+	j.mu.Lock()
+	paused, resume := j.paused, j.resume
+	j.mu.Unlock()
+
+	if paused {
+		select {
+		case <-resume:
+		case <-ctx.Done():
+		}
+	}
+	return ctx.Err() == nil
+}
+
+func (j *Job) Pause() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.paused = true
+}
+
+func (j *Job) Resume() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !j.paused {
+		return
+	}
+	j.paused = false
+	close(j.resume)
+	j.resume = make(chan struct{})
+}
+
+// Cancel stops the job; message, which is being processed at the moment, is still reported
+func (j *Job) Cancel() {
+	j.cancel()
+}
@@ -0,0 +1,754 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"DeadRabbit/commons"
+	"DeadRabbit/dump"
+	"DeadRabbit/journal"
+	"DeadRabbit/layout"
+	"DeadRabbit/management"
+	"DeadRabbit/replay"
+	"DeadRabbit/state"
+	"DeadRabbit/store"
+	"DeadRabbit/viewers"
+)
+
+// session is a triage session with a broker of one profile at a time. Store, journal and configuration are given
+// to it, rather than taken from globals, so a session could be driven without UI, e.g. in tests
+type session struct {
+	config  *configuration
+	store   *store.Store[state.State]
+	journal *journal.Journal
+	broker  state.Broker
+	// activeProfileIdx is an index of a profile in configuration, which broker is connected with
+	activeProfileIdx int
+	// generation is increased on every connection, so events of previous brokers could be told apart
+	generation    uint64
+	cancelLoading context.CancelFunc
+	bulkJob       *replay.Job
+	// dryRunOperations are collected from brokers, which were closed on profile switching
+	dryRunOperations []state.DryRunOperation
+	// unreconciled are messages, taken by an interrupted session, which weren't given back to their DLQ
+	unreconciled []journal.Entry
+	// restoreOffered tells, for which profiles restoring of unreconciled messages was offered already
+	restoreOffered map[string]bool
+}
+
+// newSession connects with the broker of the first profile
+func newSession(c *configuration, aStore *store.Store[state.State], aJournal *journal.Journal,
+	unreconciled []journal.Entry) (*session, error) {
+	sess := &session{
+		config:         c,
+		store:          aStore,
+		journal:        aJournal,
+		unreconciled:   unreconciled,
+		restoreOffered: make(map[string]bool),
+	}
+	broker, err := sess.connectBroker(c.Profiles[0])
+	if err != nil {
+		return nil, fmt.Errorf("can't connect to broker of profile %s: %w", c.Profiles[0].Name, err)
+	}
+	sess.broker = broker
+	return sess, nil
+}
+
+// close closes the broker and writes operations, skipped in a dry run, out
+func (sess *session) close() {
+	sess.broker.Close()
+	if sess.config.DryRun {
+		sess.writeDryRunReport(append(sess.dryRunOperations, sess.broker.DryRunOperations()...))
+	}
+}
+
+// activeProfile is a profile, broker is connected with
+func (sess *session) activeProfile() profile {
+	return sess.config.Profiles[sess.activeProfileIdx]
+}
+
+// reduce applies an action to the state of the session; broker operations are applied synchronously
+func (sess *session) reduce(s *state.State, a store.Action) {
+	switch action := a.(type) {
+	case state.NextMessage:
+		s.SelectedMessageIdx = nextVisibleMessageIdx(s, 1)
+	case state.PrevMessage:
+		s.SelectedMessageIdx = nextVisibleMessageIdx(s, -1)
+	case state.ToggleMessageSelection:
+		if isValidMessageIdx(s, action.MessageIdx) {
+			s.Messages[action.MessageIdx].Selected = !s.Messages[action.MessageIdx].Selected
+		}
+	case state.SelectRange:
+		if !isValidMessageIdx(s, s.SelectedMessageIdx) || !s.Filter.Matches(currentMessage(s)) {
+			break
+		}
+		s.Messages[s.SelectedMessageIdx].Selected = true
+		if next := nextVisibleMessageIdx(s, action.Direction); next >= 0 {
+			s.SelectedMessageIdx = next
+			s.Messages[next].Selected = true
+		}
+	case state.ToggleSelectAllVisible:
+		visibleIdx := s.VisibleMessagesIdx()
+		allSelected := !commons.AnyMatches(visibleIdx, func(i int) bool {
+			return !s.Messages[i].Selected
+		})
+		for _, i := range visibleIdx {
+			s.Messages[i].Selected = !allSelected
+		}
+	case state.ClearFilter:
+		s.Filter = state.MessageFilter{}
+		if s.SelectedMessageIdx < 0 {
+			s.SelectedMessageIdx = nextVisibleMessageIdx(s, 1)
+		}
+	case state.NextBodyViewer:
+		s.BodyViewer = viewers.Next(s.BodyViewer)
+	case state.ToggleShowGroups:
+		s.ShowGroups = !s.ShowGroups
+		s.SelectedGroupIdx = 0
+	case state.NextGroup:
+		if s.SelectedGroupIdx < len(s.MessageGroups())-1 {
+			s.SelectedGroupIdx++
+		}
+	case state.PrevGroup:
+		if s.SelectedGroupIdx > 0 {
+			s.SelectedGroupIdx--
+		}
+	case state.NextGroupKey:
+		if len(s.GroupKeys) > 0 {
+			s.GroupKeyIdx = (s.GroupKeyIdx + 1) % len(s.GroupKeys)
+		}
+		s.SelectedGroupIdx = 0
+	case state.FilterBySelectedGroup:
+		groups := s.MessageGroups()
+		if s.SelectedGroupIdx < 0 || s.SelectedGroupIdx >= len(groups) {
+			break
+		}
+		selected := state.GroupFilter{Key: s.GroupKey(), Value: groups[s.SelectedGroupIdx].Value}
+		if s.Filter.Group != nil && *s.Filter.Group == selected {
+			// Choosing the same group again shows all groups
+			s.Filter.Group = nil
+		} else {
+			s.Filter.Group = &selected
+		}
+		if !s.Filter.Matches(currentMessage(s)) {
+			s.SelectedMessageIdx = nextVisibleMessageIdx(s, 1)
+		}
+	case state.FilterTextChanged:
+		s.Filter.Text = action.Text
+		// Filter may hide currently selected message, or show some, when nothing was visible
+		if s.SelectedMessageIdx < 0 || !s.Filter.Matches(currentMessage(s)) {
+			s.SelectedMessageIdx = nextVisibleMessageIdx(s, 1)
+		}
+	case state.StartBulkOperation:
+		if isBulkOperationRunning(s) {
+			notify(s, "Another bulk operation is in progress")
+			break
+		}
+		if s.IsProcessingMessages() {
+			// Messages, which are processed, would be processed twice
+			notify(s, "Can't start a bulk operation while messages are processed")
+			break
+		}
+		messages := s.SelectedMessages()
+		if action.Kind == state.BulkRequeue && !action.Confirmed && sess.broker.WarnsOnReplayLimit() {
+			limited := len(commons.Filter(messages, sess.broker.ReachesReplayLimit))
+			if limited > 0 {
+				action.Confirmed = true
+				sess.store.Dispatch(state.ShowConfirmPopup{
+					Text:      fmt.Sprintf("%d of %d messages have reached replay limit. Replay them anyway?", limited, len(messages)),
+					Confirmed: action,
+				})
+				break
+			}
+		}
+		s.BulkOperation = &state.BulkOperationStruct{
+			Kind:    action.Kind,
+			Total:   len(messages),
+			Results: make([]state.BulkResult, 0, len(messages)),
+		}
+		sess.bulkJob = sess.startBulkOperation(sess.broker, action, messages)
+	case state.PauseBulkOperation:
+		if !isBulkOperationRunning(s) {
+			break
+		}
+		if s.BulkOperation.Paused {
+			sess.bulkJob.Resume()
+		} else {
+			sess.bulkJob.Pause()
+		}
+		s.BulkOperation.Paused = !s.BulkOperation.Paused
+	case state.CancelBulkOperation:
+		if !isBulkOperationRunning(s) {
+			break
+		}
+		sess.bulkJob.Cancel()
+		s.BulkOperation.Paused = false
+	case state.BulkOperationFinished:
+		if s.BulkOperation != nil {
+			s.BulkOperation.Done = true
+		}
+		sess.bulkJob = nil
+	case state.BulkMessageProcessed:
+		if s.BulkOperation == nil {
+			break
+		}
+		s.BulkOperation.Results = append(s.BulkOperation.Results, action.Result)
+		idx := s.FindMessage(action.Result.MessageId)
+		if idx < 0 {
+			break
+		}
+		if action.Result.Error != nil {
+			s.Messages[idx].Error = action.Result.Error.Error()
+		} else {
+			sess.journal.Record(bulkJournalActions[s.BulkOperation.Kind], action.Result.MessageId)
+			removeMessage(s, idx)
+		}
+	case state.LoadMessages:
+		if s.LoadingMessages {
+			break
+		}
+		s.LoadingMessages = true
+		ctx, cancel := context.WithCancel(context.Background())
+		sess.cancelLoading = cancel
+		go sess.loadMessages(ctx, sess.broker, sess.activeProfile())
+	case state.MessagesLoaded:
+		s.Messages = append(s.Messages, action.Messages...)
+		if s.SelectedMessageIdx < 0 && len(s.Messages) > 0 {
+			s.SelectedMessageIdx = 0
+		}
+	case state.CancelLoading:
+		if sess.cancelLoading != nil {
+			sess.cancelLoading()
+		}
+	case state.LoadingFinished:
+		s.LoadingMessages = false
+		sess.cancelLoading = nil
+		if action.QueueDepth >= 0 {
+			s.QueueDepth = action.QueueDepth
+		}
+		if action.Error != nil && !errors.Is(action.Error, context.Canceled) {
+			log.Printf("Failed to load messages, %s", action.Error.Error())
+			notify(s, "Failed to load messages: "+action.Error.Error())
+		}
+	case state.QueueStatsUpdated:
+		if action.Generation != sess.generation {
+			// Stats of a previous profile's broker, which is closed already
+			break
+		}
+		isFirst := s.DlqStats.At.IsZero()
+		s.DlqStats = action.Dlq
+		s.TargetQueueStats = action.Queue
+		if action.Dlq.Error != "" || s.LoadingMessages {
+			// Depth is changing by loading itself, so it's updated, once loading is finished
+			break
+		}
+		// Loaded messages aren't counted by broker, so any surplus over a known depth is new dead letters
+		if arrived := action.Dlq.Messages - s.QueueDepth; arrived > 0 && !isFirst &&
+			sess.activeProfile().alertsOnNewMessages() {
+			notify(s, fmt.Sprintf("%d new message(s) in DLQ", arrived))
+		}
+		s.QueueDepth = action.Dlq.Messages
+	case state.ReleaseMessages:
+		if s.LoadingMessages || isBulkOperationRunning(s) || s.IsProcessingMessages() {
+			// Batches, loaded meanwhile, would be left behind, and processed messages would be given back
+			notify(s, "Can't release messages while messages are loading or processed")
+			break
+		}
+		if taken := takenMessages(s.Messages); len(taken) > 0 {
+			if err := sess.broker.ReleaseMessages(taken); err != nil {
+				log.Printf("Failed to release messages, err: %s", err.Error())
+				notify(s, "Failed to release messages: "+err.Error())
+				break
+			}
+			sess.journal.Record(journal.Released, messageIds(taken)...)
+			s.QueueDepth += len(taken)
+			// Imported messages aren't in the DLQ, so they stay in the list
+			s.Messages = commons.Filter(s.Messages, isImported)
+			s.SelectedMessageIdx = -1
+			s.SelectedMessageIdx = nextVisibleMessageIdx(s, 1)
+		}
+	case state.RequeueMessage:
+		if isBulkOperationRunning(s) {
+			notify(s, bulkOperationRunningNotice)
+			break
+		}
+		if !isValidMessageIdx(s, action.MessageIdx) {
+			break
+		}
+
+		message := s.Messages[action.MessageIdx]
+		if message.Processing {
+			notify(s, messageProcessingNotice)
+			break
+		}
+		if !action.Confirmed && sess.broker.WarnsOnReplayLimit() && sess.broker.ReachesReplayLimit(message) {
+			action.Confirmed = true
+			sess.store.Dispatch(state.ShowConfirmPopup{
+				Text:      fmt.Sprintf("Message has been replayed %d times already. Replay it again?", message.ReplayCount),
+				Confirmed: action,
+			})
+			break
+		}
+
+		sess.processMessage(s, action.MessageIdx, state.BulkRequeue, state.Destination{})
+	case state.ToggleShowHeaders:
+		s.ShowHeaders = !s.ShowHeaders
+	case state.BrokerStatusChanged:
+		if action.Generation != sess.generation {
+			// Closing connection of a previous profile reports its status too
+			break
+		}
+		s.BrokerStatus = state.BrokerStatusStruct{
+			Status: action.Status,
+			At:     time.Now(),
+		}
+		if action.Error != nil {
+			s.BrokerStatus.Error = action.Error.Error()
+		}
+		if taken := takenMessages(s.Messages); action.Status != state.Connected && sess.broker.IsBrowsing() && len(taken) > 0 {
+			// Unacknowledged messages are returned to the DLQ by broker, once channel is closed
+			sess.journal.Record(journal.Released, messageIds(taken)...)
+			s.Messages = commons.Filter(s.Messages, isImported)
+			s.SelectedMessageIdx = -1
+			s.SelectedMessageIdx = nextVisibleMessageIdx(s, 1)
+			notify(s, "Connection lost; loaded messages were returned to the DLQ")
+		}
+		if action.Status == state.Connected {
+			sess.offerRestore(s)
+		}
+	case state.RestoreMessages:
+		sess.restoreMessages(s)
+	case state.DropMessage:
+		if isBulkOperationRunning(s) {
+			notify(s, bulkOperationRunningNotice)
+			break
+		}
+		if !isValidMessageIdx(s, action.MessageIdx) {
+			break
+		}
+		if s.Messages[action.MessageIdx].Processing {
+			notify(s, messageProcessingNotice)
+			break
+		}
+
+		sess.processMessage(s, action.MessageIdx, state.BulkDrop, state.Destination{})
+	case state.MoveMessage:
+		if isBulkOperationRunning(s) {
+			notify(s, bulkOperationRunningNotice)
+			break
+		}
+		if !isValidMessageIdx(s, action.MessageIdx) || len(s.MoveToPopup.Options) == 0 {
+			break
+		}
+		if s.Messages[action.MessageIdx].Processing {
+			notify(s, messageProcessingNotice)
+			break
+		}
+		destination, ok := s.MoveToPopup.Options[s.MoveToPopup.SelectedIdx].Value.(state.Destination)
+		if !ok {
+			log.Printf("Can't get destination from selected option value - invalid type")
+			break
+		}
+
+		sess.processMessage(s, action.MessageIdx, state.BulkMove, destination)
+	case state.MessageProcessed:
+		idx := s.FindMessage(action.MessageId)
+		if idx < 0 {
+			// Message was dropped from the list meanwhile, e.g. because connection was lost
+			break
+		}
+		s.Messages[idx].Processing = false
+		if action.Error != nil {
+			log.Printf("Failed to %s message, err: %s", action.Kind, action.Error.Error())
+			s.Messages[idx].Error = action.Error.Error()
+			notify(s, fmt.Sprintf("Failed to %s message: %s", action.Kind, action.Error.Error()))
+			break
+		}
+
+		sess.journal.Record(bulkJournalActions[action.Kind], action.MessageId)
+		removeMessage(s, idx)
+		notifyDryRun(s, processedNotices[action.Kind])
+	case state.MessageEdited:
+		if isBulkOperationRunning(s) {
+			notify(s, bulkOperationRunningNotice)
+			break
+		}
+		if !isValidMessageIdx(s, action.MessageIdx) {
+			break
+		}
+		if s.Messages[action.MessageIdx].Processing {
+			// Edit would be lost, as the message is published, as it was
+			notify(s, messageProcessingNotice)
+			break
+		}
+		original := s.Messages[action.MessageIdx]
+		edited := action.Message
+		edited.Original = original.Original
+		if edited.Original == nil {
+			edited.Original = &original
+		}
+		edited.Error = ""
+		// Replay count header could be edited too
+		edited.ReplayCount = replay.Count(edited.Headers)
+		s.Messages[action.MessageIdx] = edited
+	case state.MoveToListNextOption:
+		if s.MoveToPopup.SelectedIdx < len(s.MoveToPopup.Options)-1 {
+			s.MoveToPopup.SelectedIdx++
+		}
+	case state.MoveToListPrevOption:
+		if s.MoveToPopup.SelectedIdx > 0 {
+			s.MoveToPopup.SelectedIdx--
+		}
+	case state.ImportMessages:
+		path := strings.TrimSpace(s.ImportPath)
+		if path == "" {
+			break
+		}
+		messages, err := dump.Read(path)
+		if err != nil {
+			log.Printf("Failed to import messages, err: %s", err.Error())
+			notify(s, "Failed to import messages: "+err.Error())
+			break
+		}
+		for _, message := range messages {
+			message.Id = nextMessageId()
+			message.Imported = true
+			if message.Destination == (state.Destination{}) {
+				// Messages, exported without a destination, are replayed the same way as loaded ones
+				message.Destination = sess.broker.ResolveDestination(message)
+			}
+			s.Messages = append(s.Messages, message)
+		}
+		if s.SelectedMessageIdx < 0 && len(s.Messages) > 0 {
+			s.SelectedMessageIdx = 0
+		}
+		notify(s, fmt.Sprintf("%d messages are imported from %s", len(messages), path))
+	case state.ShowExportPopup:
+		s.ExportPopup.Options = getExportOptions(s)
+	case state.ExportListNextOption:
+		if s.ExportPopup.SelectedIdx < len(s.ExportPopup.Options)-1 {
+			s.ExportPopup.SelectedIdx++
+		}
+	case state.ExportListPrevOption:
+		if s.ExportPopup.SelectedIdx > 0 {
+			s.ExportPopup.SelectedIdx--
+		}
+	case state.ExportMessages:
+		if len(s.ExportPopup.Options) == 0 {
+			notify(s, "Nothing to export")
+			break
+		}
+		scope, ok := s.ExportPopup.Options[s.ExportPopup.SelectedIdx].Value.(state.ExportScope)
+		if !ok {
+			log.Printf("Can't get export scope from selected option value - invalid type")
+			break
+		}
+		sess.exportMessages(s, scope, action.Directory)
+	case state.ProfilesListNextOption:
+		if s.SelectProfilePopup.SelectedIdx < len(s.SelectProfilePopup.Options)-1 {
+			s.SelectProfilePopup.SelectedIdx++
+		}
+	case state.ProfilesListPrevOption:
+		if s.SelectProfilePopup.SelectedIdx > 0 {
+			s.SelectProfilePopup.SelectedIdx--
+		}
+	case state.SwitchProfile:
+		profileIdx, ok := s.SelectProfilePopup.Options[s.SelectProfilePopup.SelectedIdx].Value.(int)
+		if !ok {
+			log.Printf("Can't get profile from selected option value - invalid type")
+			break
+		}
+		sess.switchProfile(s, profileIdx)
+	case state.DiscoverQueues:
+		p := sess.activeProfile()
+		if p.isKafka() || p.isMemory() {
+			notify(s, "Queues could be discovered only for RabbitMQ profiles")
+			break
+		}
+		if p.Management.Url == "" {
+			notify(s, "Management API url isn't configured for profile "+p.Name)
+			break
+		}
+		go sess.discoverQueues(sess.activeProfileIdx, p)
+	case state.QueuesDiscovered:
+		if action.ProfileIdx != sess.activeProfileIdx {
+			// Profile was switched meanwhile, so queues are of another broker
+			break
+		}
+		if action.Error != nil {
+			log.Printf("Can't list queues, err: %s", action.Error.Error())
+			notify(s, "Can't list queues: "+action.Error.Error())
+			break
+		}
+		s.SelectQueuePopup.Options = action.Options
+		s.SelectQueuePopup.SelectedIdx = 0
+		sess.store.Dispatch(state.ShowQueuesPopup{})
+	case state.QueuesListNextOption:
+		if s.SelectQueuePopup.SelectedIdx < len(s.SelectQueuePopup.Options)-1 {
+			s.SelectQueuePopup.SelectedIdx++
+		}
+	case state.QueuesListPrevOption:
+		if s.SelectQueuePopup.SelectedIdx > 0 {
+			s.SelectQueuePopup.SelectedIdx--
+		}
+	case state.UseSelectedQueue:
+		if len(s.SelectQueuePopup.Options) == 0 {
+			break
+		}
+		queue, ok := s.SelectQueuePopup.Options[s.SelectQueuePopup.SelectedIdx].Value.(management.Queue)
+		if !ok {
+			log.Printf("Can't get queue from selected option value - invalid type")
+			break
+		}
+		p := sess.activeProfile()
+		p.Rabbitmq.Dlq = queue.Name
+		if len(queue.DeadLetteredFrom) > 0 {
+			p.Rabbitmq.Queue = queue.DeadLetteredFrom[0]
+		}
+		if sess.switchProfile(s, sess.activeProfileIdx, p) {
+			s.SelectProfilePopup.Options[sess.activeProfileIdx].Text = getProfileOptionText(p)
+		}
+	case state.QueriesListNextOption:
+		if s.SelectQueryPopup.SelectedIdx < len(s.SelectQueryPopup.Options)-1 {
+			s.SelectQueryPopup.SelectedIdx += 1
+		}
+	case state.QueriesListPrevOption:
+		if s.SelectQueryPopup.SelectedIdx > 0 {
+			s.SelectQueryPopup.SelectedIdx -= 1
+		}
+	case state.ShowFillQueryParamsPopup:
+		context, ok := s.SelectQueryPopup.Options[s.SelectQueryPopup.SelectedIdx].Value.(state.QueryContext)
+		if !ok {
+			log.Printf("Can't get query context from selected option value - invalid type")
+			break
+		}
+		s.FillQueryParamsPopup = state.FillQueryParamsPopupData{
+			Ctx:              context,
+			SelectedParamIdx: 0,
+		}
+	case state.FillQueryParamsPopupNextField:
+		if s.FillQueryParamsPopup.SelectedParamIdx < len(s.FillQueryParamsPopup.Ctx.Params)-1 {
+			s.FillQueryParamsPopup.SelectedParamIdx++
+		}
+	case state.FillQueryParamsPopupPrevField:
+		if s.FillQueryParamsPopup.SelectedParamIdx > 0 {
+			s.FillQueryParamsPopup.SelectedParamIdx--
+		}
+	case state.StopInputMode:
+		s.InputMode = false
+	case state.StartInputMode:
+		s.InputMode = true
+	case state.RunSqlQuery:
+		ctx := s.FillQueryParamsPopup.Ctx
+		params := make(map[string]string)
+		for _, p := range ctx.Params {
+			params[p.Name] = fmt.Sprintf(p.Format, p.Value)
+		}
+		results := ctx.Db.Query(ctx.Query, params)
+
+		s.DatabaseOutputs = &state.DatabaseData{
+			Results: results,
+		}
+
+		sqlViewRows := layout.CalculateRows(results)
+
+		s.SqlResultsView = &state.SqlResultsViewData{
+			DX:    0,
+			DY:    0,
+			MaxDX: len(sqlViewRows[0]),
+			MaxDY: len(sqlViewRows),
+			Rows:  sqlViewRows,
+		}
+	case state.HideSqlResults:
+		s.DatabaseOutputs = nil
+	case state.SqlViewScrollDown:
+		if s.SqlResultsView.DY < s.SqlResultsView.MaxDY {
+			s.SqlResultsView.DY++
+		}
+	case state.SqlViewScrollUp:
+		if s.SqlResultsView.DY > 0 {
+			s.SqlResultsView.DY--
+		}
+	case state.SqlViewScrollRight:
+		if s.SqlResultsView.DX < s.SqlResultsView.MaxDX {
+			s.SqlResultsView.DX++
+		}
+	case state.SqlViewScrollLeft:
+		if s.SqlResultsView.DX > 0 {
+			s.SqlResultsView.DX--
+		}
+	}
+}
+
+// switchProfile releases loaded messages and reconnects with the given profile.
+// Profile could be changed along the way, e.g. to use another DLQ. Returns false, if switching was impossible
+func (sess *session) switchProfile(s *state.State, profileIdx int, changed ...profile) bool {
+	if s.LoadingMessages || isBulkOperationRunning(s) || s.IsProcessingMessages() {
+		notify(s, "Can't switch profile while messages are loading or processed")
+		return false
+	}
+	if taken := takenMessages(s.Messages); len(taken) > 0 {
+		if err := sess.broker.ReleaseMessages(taken); err != nil && !sess.broker.IsBrowsing() {
+			// Drained messages exist only here, so they can't be just left behind
+			log.Printf("Failed to release messages, err: %s", err.Error())
+			notify(s, "Can't switch profile, failed to release messages: "+err.Error())
+			return false
+		}
+		sess.journal.Record(journal.Released, messageIds(taken)...)
+		s.QueueDepth += len(taken)
+	}
+	s.Messages = commons.Filter(s.Messages, isImported)
+	s.SelectedMessageIdx = -1
+	s.SelectedMessageIdx = nextVisibleMessageIdx(s, 1)
+
+	selectedProfile := sess.config.Profiles[profileIdx]
+	if len(changed) > 0 {
+		selectedProfile = changed[0]
+	}
+	broker, err := sess.connectBroker(selectedProfile)
+	if err != nil {
+		// Current broker is kept, so loading messages again is possible
+		log.Printf("Can't switch profile, err: %s", err.Error())
+		notify(s, "Can't switch profile: "+err.Error())
+		return false
+	}
+	sess.broker.Close()
+	sess.dryRunOperations = append(sess.dryRunOperations, sess.broker.DryRunOperations()...)
+	sess.broker = broker
+
+	sess.config.Profiles[profileIdx] = selectedProfile
+	sess.activeProfileIdx = profileIdx
+	s.Messages = []state.MessageStruct{}
+	s.SelectedMessageIdx = -1
+	s.ActiveProfile = selectedProfile.Name
+	s.MoveToPopup.Options = getDestinationOptions(selectedProfile)
+	s.QueueDepth = 0
+	s.DlqStats = state.QueueStatsStruct{}
+	s.TargetQueueStats = state.QueueStatsStruct{}
+	s.BrokerStatus = state.BrokerStatusStruct{Status: state.Connecting, At: time.Now()}
+	return true
+}
+
+// discoverQueues lists queues of the profile's vhost without blocking UI, as management API could be slow to respond
+func (sess *session) discoverQueues(profileIdx int, p profile) {
+	queues, err := management.New(p.managementConfiguration(), nil).ListQueues(p.Rabbitmq.Vhost)
+	sess.store.Enqueue(state.QueuesDiscovered{
+		ProfileIdx: profileIdx,
+		Options:    getQueueOptions(queues),
+		Error:      err,
+	})
+}
+
+// unreconciledOfActiveProfile returns unreconciled messages, which were taken from the DLQ of the active profile
+func (sess *session) unreconciledOfActiveProfile() []journal.Entry {
+	p := sess.activeProfile()
+	return commons.Filter(sess.unreconciled, func(e journal.Entry) bool {
+		return e.Profile == p.Name && e.Dlq == p.dlq()
+	})
+}
+
+// offerRestore asks once per profile, whether to restore messages, which were taken by an interrupted session
+func (sess *session) offerRestore(s *state.State) {
+	entries := sess.unreconciledOfActiveProfile()
+	if len(entries) == 0 || sess.restoreOffered[s.ActiveProfile] || s.DryRun {
+		return
+	}
+	sess.restoreOffered[s.ActiveProfile] = true
+	sess.store.Dispatch(state.ShowConfirmPopup{
+		Text: fmt.Sprintf("%d messages were taken from %s by an interrupted session and weren't returned. "+
+			"Restore them to the DLQ?", len(entries), sess.activeProfile().dlq()),
+		Confirmed: state.RestoreMessages{},
+	})
+}
+
+func (sess *session) restoreMessages(s *state.State) {
+	restored := make(map[journal.Key]bool)
+	for _, entry := range sess.unreconciledOfActiveProfile() {
+		if err := sess.broker.RestoreMessages([]state.MessageStruct{entry.ToMessage()}); err != nil {
+			log.Printf("Failed to restore message %s/%d, err: %s", entry.Session, entry.MessageId, err.Error())
+			continue
+		}
+		sess.journal.RecordKey(journal.Restored, entry.Key)
+		restored[entry.Key] = true
+	}
+
+	failed := len(sess.unreconciledOfActiveProfile()) - len(restored)
+	sess.unreconciled = commons.Filter(sess.unreconciled, func(e journal.Entry) bool {
+		return !restored[e.Key]
+	})
+	s.QueueDepth += len(restored)
+	if failed > 0 {
+		notify(s, fmt.Sprintf("Restored %d messages, %d failed; they'll be offered again on the next start", len(restored), failed))
+		return
+	}
+	notify(s, fmt.Sprintf("Restored %d messages to the DLQ", len(restored)))
+}
+
+// loadMessages journals messages, as soon as they're taken from the DLQ of the profile, and enqueues them for the list.
+// Journaling doesn't wait for the UI loop, so messages, taken right before exit or crash, could be restored later
+func (sess *session) loadMessages(ctx context.Context, broker state.Broker, p profile) {
+	err := broker.LoadMessages(ctx, func(messages []state.MessageStruct) {
+		for i := range messages {
+			messages[i].Id = nextMessageId()
+		}
+		sess.journal.Taken(p.Name, p.dlq(), !broker.IsBrowsing(), messages)
+		sess.store.Enqueue(state.MessagesLoaded{Messages: messages})
+	})
+
+	depth, depthErr := broker.CountMessages()
+	if depthErr != nil {
+		log.Printf("Can't count messages in DLQ, err: %s", depthErr.Error())
+		depth = -1
+	}
+
+	sess.store.Enqueue(state.LoadingFinished{QueueDepth: depth, Error: err})
+}
+
+// connectBroker connects with the broker of the profile; generation is increased only, if connecting succeeded
+func (sess *session) connectBroker(p profile) (state.Broker, error) {
+	generation := sess.generation + 1
+	broker, err := newBroker(p, func(status state.ConnectionStatus, err error) {
+		sess.store.Enqueue(state.BrokerStatusChanged{Status: status, Error: err, Generation: generation})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sess.generation = generation
+	broker.MonitorQueues(func(dlq, queue state.QueueStatsStruct) {
+		sess.store.Enqueue(state.QueueStatsUpdated{Dlq: dlq, Queue: queue, Generation: generation})
+	})
+	return broker, nil
+}
+
+// writeDryRunReport exports operations, skipped in a dry run, as JSON lines
+func (sess *session) writeDryRunReport(operations []state.DryRunOperation) {
+	if len(operations) == 0 {
+		return
+	}
+	path := sess.config.DryRunReport
+	if path == "" {
+		path = defaultDryRunReport
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		log.Printf("Can't write dry run report, err: %s", err.Error())
+		return
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	for _, operation := range operations {
+		if err := encoder.Encode(operation); err != nil {
+			log.Printf("Can't write dry run report, err: %s", err.Error())
+			return
+		}
+	}
+	log.Printf("DRY RUN: %d skipped operations are written to %s", len(operations), path)
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"DeadRabbit/journal"
+	"DeadRabbit/rabbitmq"
+	"DeadRabbit/replay"
+	"DeadRabbit/state"
+	"DeadRabbit/store"
+)
+
+// demoConfiguration has in-memory profiles, seeded from the built-in demo fixture with 6 messages in its DLQ
+func demoConfiguration(mode string, names ...string) *configuration {
+	c := &configuration{}
+	for _, name := range names {
+		c.Profiles = append(c.Profiles, profile{
+			Name:   name,
+			Broker: memoryBroker,
+			Rabbitmq: rabbitmq.Configuration{
+				Mode:         mode,
+				Monitor:      rabbitmq.MonitorConfiguration{Interval: -1},
+				Destinations: []rabbitmq.NamedDestination{{Name: "parking lot", RoutingKey: "orders.parking-lot"}},
+			},
+		})
+	}
+	return c
+}
+
+type testSession struct {
+	*session
+	store       *store.Store[state.State]
+	journalPath string
+}
+
+func newTestSession(t *testing.T, c *configuration, journalPath string) testSession {
+	t.Helper()
+	unreconciled, err := journal.Unreconciled(journalPath)
+	if err != nil {
+		t.Fatalf("Unreconciled() error = %v", err)
+	}
+	aJournal, err := journal.Open(journalPath)
+	if err != nil {
+		t.Fatalf("journal.Open() error = %v", err)
+	}
+	t.Cleanup(func() { _ = aJournal.Close() })
+
+	aStore := store.NewStore(initialState(c, nil))
+	sess, err := newSession(c, aStore, aJournal, unreconciled)
+	if err != nil {
+		t.Fatalf("newSession() error = %v", err)
+	}
+	t.Cleanup(sess.close)
+	aStore.AddReducer(sess.reduce)
+
+	ts := testSession{session: sess, store: aStore, journalPath: journalPath}
+	ts.dispatchQueued(t, func(a store.Action) bool {
+		changed, ok := a.(state.BrokerStatusChanged)
+		return ok && changed.Status == state.Connected
+	})
+	return ts
+}
+
+// dispatchQueued dispatches actions, enqueued by background goroutines, as UI loop does, until the awaited one
+func (ts testSession) dispatchQueued(t *testing.T, awaited func(store.Action) bool) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case action := <-ts.store.Queued():
+			ts.store.Dispatch(action)
+			if awaited(action) {
+				return
+			}
+		case <-timeout:
+			t.Fatal("awaited action isn't enqueued in time")
+		}
+	}
+}
+
+func (ts testSession) load(t *testing.T) {
+	t.Helper()
+	ts.store.Dispatch(state.LoadMessages{})
+	ts.dispatchQueued(t, func(a store.Action) bool {
+		_, ok := a.(state.LoadingFinished)
+		return ok
+	})
+}
+
+// process dispatches an operation on a single message and dispatches its result, once broker has processed it
+func (ts testSession) process(t *testing.T, action store.Action) {
+	t.Helper()
+	ts.store.Dispatch(action)
+	ts.dispatchQueued(t, func(a store.Action) bool {
+		_, ok := a.(state.MessageProcessed)
+		return ok
+	})
+}
+
+func (ts testSession) assertLoaded(t *testing.T, want int) {
+	t.Helper()
+	if got := len(ts.store.GetCurrent().Messages); got != want {
+		t.Fatalf("%d messages are loaded, want %d", got, want)
+	}
+}
+
+func (ts testSession) assertUnreconciled(t *testing.T, want int) {
+	t.Helper()
+	entries, err := journal.Unreconciled(ts.journalPath)
+	if err != nil {
+		t.Fatalf("Unreconciled() error = %v", err)
+	}
+	if len(entries) != want {
+		t.Errorf("journal has %d unreconciled messages, want %d", len(entries), want)
+	}
+}
+
+func (ts testSession) assertQueueDepth(t *testing.T, want int) {
+	t.Helper()
+	if got := ts.store.GetCurrent().QueueDepth; got != want {
+		t.Errorf("queue depth = %d, want %d", got, want)
+	}
+	if got, _ := ts.broker.CountMessages(); got != want {
+		t.Errorf("broker counts %d messages, want %d", got, want)
+	}
+}
+
+func TestSessionTriagesDrainedMessages(t *testing.T) {
+	ts := newTestSession(t, demoConfiguration(rabbitmq.DrainMode, "demo"), filepath.Join(t.TempDir(), "journal.jsonl"))
+
+	ts.load(t)
+	ts.assertLoaded(t, 6)
+	ts.assertQueueDepth(t, 0)
+	// Messages are journaled by the loader, as soon as they are taken
+	ts.assertUnreconciled(t, 6)
+
+	ts.process(t, state.RequeueMessage{MessageIdx: 0})
+	ts.process(t, state.DropMessage{MessageIdx: 0})
+	ts.process(t, state.MoveMessage{MessageIdx: 0})
+	ts.assertLoaded(t, 3)
+	ts.assertUnreconciled(t, 3)
+
+	edited := ts.store.GetCurrent().Messages[0]
+	edited.Headers = map[string]any{replay.CountHeader: int64(2)}
+	ts.store.Dispatch(state.MessageEdited{MessageIdx: 0, Message: edited})
+	if count := ts.store.GetCurrent().Messages[0].ReplayCount; count != 2 {
+		t.Errorf("replay count of edited message = %d, want 2", count)
+	}
+
+	ts.store.Dispatch(state.ReleaseMessages{})
+	ts.assertLoaded(t, 0)
+	ts.assertQueueDepth(t, 3)
+	ts.assertUnreconciled(t, 0)
+
+	ts.load(t)
+	ts.assertLoaded(t, 3)
+	if count := ts.store.GetCurrent().Messages[0].ReplayCount; count != 2 {
+		t.Errorf("replay count of released message = %d, want 2", count)
+	}
+}
+
+func TestSessionDoesNotReleaseWhileLoading(t *testing.T) {
+	ts := newTestSession(t, demoConfiguration(rabbitmq.DrainMode, "demo"), filepath.Join(t.TempDir(), "journal.jsonl"))
+
+	ts.store.Dispatch(state.LoadMessages{})
+	ts.store.Dispatch(state.ReleaseMessages{})
+	if notification := ts.store.GetCurrent().Notification; notification == nil {
+		t.Error("releasing while loading should be refused with a notification")
+	}
+	ts.dispatchQueued(t, func(a store.Action) bool {
+		_, ok := a.(state.LoadingFinished)
+		return ok
+	})
+	ts.assertLoaded(t, 6)
+}
+
+func TestSessionRefusesMessageOperationsDuringBulkOperation(t *testing.T) {
+	c := demoConfiguration(rabbitmq.DrainMode, "demo")
+	// A message per second keeps the operation running, while single message operations are tried
+	c.Replay = replay.Configuration{Rate: 1}
+	ts := newTestSession(t, c, filepath.Join(t.TempDir(), "journal.jsonl"))
+	ts.load(t)
+
+	ts.store.Dispatch(state.ToggleSelectAllVisible{})
+	ts.store.Dispatch(state.StartBulkOperation{Kind: state.BulkDrop})
+	last := len(ts.store.GetCurrent().Messages) - 1
+	edited := ts.store.GetCurrent().Messages[last]
+	edited.Body = "edited"
+	for _, action := range []store.Action{
+		state.RequeueMessage{MessageIdx: last},
+		state.DropMessage{MessageIdx: last},
+		state.MoveMessage{MessageIdx: last},
+		state.MessageEdited{MessageIdx: last, Message: edited},
+	} {
+		ts.store.Dispatch(action)
+		if notification := ts.store.GetCurrent().Notification; notification == nil ||
+			notification.Value != bulkOperationRunningNotice {
+			t.Errorf("%T should be refused during a bulk operation", action)
+		}
+	}
+	ts.assertLoaded(t, 6)
+	if body := ts.store.GetCurrent().Messages[last].Body; body == "edited" {
+		t.Error("edit should be refused during a bulk operation")
+	}
+
+	ts.store.Dispatch(state.CancelBulkOperation{})
+	ts.dispatchQueued(t, func(a store.Action) bool {
+		_, ok := a.(state.BulkOperationFinished)
+		return ok
+	})
+	ts.process(t, state.DropMessage{MessageIdx: 0})
+	ts.assertUnreconciled(t, len(ts.store.GetCurrent().Messages))
+}
+
+func TestSessionRefusesOperationsOnMessageBeingProcessed(t *testing.T) {
+	ts := newTestSession(t, demoConfiguration(rabbitmq.DrainMode, "demo"), filepath.Join(t.TempDir(), "journal.jsonl"))
+	ts.load(t)
+
+	// Result of requeueing is enqueued by a background goroutine, so it isn't dispatched yet
+	ts.store.Dispatch(state.RequeueMessage{MessageIdx: 0})
+	if !ts.store.GetCurrent().Messages[0].Processing {
+		t.Fatal("requeued message should be processing, until broker has confirmed it")
+	}
+	edited := ts.store.GetCurrent().Messages[0]
+	edited.Body = "edited"
+	for _, action := range []store.Action{
+		state.DropMessage{MessageIdx: 0},
+		state.MessageEdited{MessageIdx: 0, Message: edited},
+	} {
+		ts.store.Dispatch(action)
+		if notification := ts.store.GetCurrent().Notification; notification == nil ||
+			notification.Value != messageProcessingNotice {
+			t.Errorf("%T should be refused, while message is processed", action)
+		}
+	}
+	ts.store.Dispatch(state.ReleaseMessages{})
+	ts.assertLoaded(t, 6)
+
+	ts.dispatchQueued(t, func(a store.Action) bool {
+		_, ok := a.(state.MessageProcessed)
+		return ok
+	})
+	ts.assertLoaded(t, 5)
+	ts.assertUnreconciled(t, 5)
+}
+
+func TestSessionKeepsSelectionOnVisibleMessages(t *testing.T) {
+	ts := newTestSession(t, demoConfiguration(rabbitmq.DrainMode, "demo"), filepath.Join(t.TempDir(), "journal.jsonl"))
+	ts.load(t)
+
+	ts.store.Dispatch(state.FilterTextChanged{Text: "no message contains it"})
+	if idx := ts.store.GetCurrent().SelectedMessageIdx; idx != -1 {
+		t.Errorf("selected message idx = %d, want -1, when nothing is visible", idx)
+	}
+	ts.store.Dispatch(state.SelectRange{Direction: 1})
+	current := ts.store.GetCurrent()
+	if selected := current.SelectedMessages(); len(selected) != 0 {
+		t.Errorf("%d messages are marked, want none", len(selected))
+	}
+
+	ts.store.Dispatch(state.ClearFilter{})
+	if idx := ts.store.GetCurrent().SelectedMessageIdx; idx != 0 {
+		t.Errorf("selected message idx = %d, want 0, once the filter is cleared", idx)
+	}
+}
+
+func TestSessionAppliesBulkOperationsToVisibleMarkedMessages(t *testing.T) {
+	ts := newTestSession(t, demoConfiguration(rabbitmq.DrainMode, "demo"), filepath.Join(t.TempDir(), "journal.jsonl"))
+	ts.load(t)
+
+	// Messages of customer c-17 are marked, then only ones in EUR are shown
+	ts.store.Dispatch(state.FilterTextChanged{Text: "c-17"})
+	ts.store.Dispatch(state.ToggleSelectAllVisible{})
+	ts.store.Dispatch(state.FilterTextChanged{Text: "EUR"})
+	current := ts.store.GetCurrent()
+	marked := current.SelectedMessages()
+	if len(marked) != 1 || marked[0].Properties.MessageId != "order-1001" {
+		t.Fatalf("bulk operation would be applied to %+v, want only order-1001", marked)
+	}
+
+	ts.store.Dispatch(state.StartBulkOperation{Kind: state.BulkDrop})
+	ts.dispatchQueued(t, func(a store.Action) bool {
+		_, ok := a.(state.BulkOperationFinished)
+		return ok
+	})
+	ts.assertLoaded(t, 5)
+	current = ts.store.GetCurrent()
+	if idx := current.FindMessage(marked[0].Id); idx >= 0 {
+		t.Error("marked visible message should be dropped")
+	}
+}
+
+func TestSessionImportsMessagesToReplayTarget(t *testing.T) {
+	ts := newTestSession(t, demoConfiguration(rabbitmq.DrainMode, "demo"), filepath.Join(t.TempDir(), "journal.jsonl"))
+	path := filepath.Join(t.TempDir(), "messages.jsonl")
+	documents := `{"body": "fixed", "properties": {"MessageId": "fixed-1"}}
+{"body": "moved", "properties": {"MessageId": "moved-1"}, "destination": {"RoutingKey": "orders.parking-lot"}}
+`
+	if err := os.WriteFile(path, []byte(documents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Import path is typed in the popup, which has its own reducer
+	s := ts.store.GetCurrent()
+	s.ImportPath = path
+	ts.reduce(&s, state.ImportMessages{})
+
+	if len(s.Messages) != 2 {
+		t.Fatalf("%d messages are imported, want 2", len(s.Messages))
+	}
+	if destination := s.Messages[0].Destination; destination != (state.Destination{RoutingKey: "orders"}) {
+		t.Errorf("message without destination is imported to %+v, want the queue of the profile", destination)
+	}
+	if destination := s.Messages[1].Destination; destination != (state.Destination{RoutingKey: "orders.parking-lot"}) {
+		t.Errorf("message is imported to %+v, want its own destination", destination)
+	}
+}
+
+func TestSessionRestoresMessagesOfInterruptedSession(t *testing.T) {
+	journalPath := filepath.Join(t.TempDir(), "journal.jsonl")
+	interrupted := newTestSession(t, demoConfiguration(rabbitmq.DrainMode, "demo"), journalPath)
+	interrupted.load(t)
+	interrupted.process(t, state.DropMessage{MessageIdx: 0})
+	interrupted.assertUnreconciled(t, 5)
+
+	// The next session starts with a freshly seeded broker, so restored messages are added to the seeded ones
+	ts := newTestSession(t, demoConfiguration(rabbitmq.DrainMode, "demo"), journalPath)
+	ts.store.Dispatch(state.RestoreMessages{})
+	if count, _ := ts.broker.CountMessages(); count != 6+5 {
+		t.Errorf("broker counts %d messages, want %d", count, 6+5)
+	}
+	ts.assertUnreconciled(t, 0)
+}
+
+func TestSessionIgnoresEventsOfPreviousBroker(t *testing.T) {
+	ts := newTestSession(t, demoConfiguration(rabbitmq.BrowseMode, "first", "second"),
+		filepath.Join(t.TempDir(), "journal.jsonl"))
+	ts.load(t)
+	previous := ts.generation
+
+	ts.store.Dispatch(state.ProfilesListNextOption{})
+	ts.store.Dispatch(state.SwitchProfile{})
+	if ts.activeProfile().Name != "second" || ts.generation == previous {
+		t.Fatalf("profile isn't switched")
+	}
+	ts.assertLoaded(t, 0)
+
+	ts.store.Dispatch(state.BrokerStatusChanged{Status: state.Failed, Generation: previous})
+	if status := ts.store.GetCurrent().BrokerStatus.Status; status == state.Failed {
+		t.Error("status of the previous broker shouldn't be shown")
+	}
+}
@@ -9,6 +9,24 @@ type PrevMessage struct {
 type LoadMessages struct {
 }
 
+type MessagesLoaded struct {
+	Messages []MessageStruct
+}
+
+type LoadingFinished struct {
+	// QueueDepth is negative, if it's unknown
+	QueueDepth int
+	Error      error
+}
+
+type CancelLoading struct {
+}
+
+// Exit releases loaded messages and quits, once loading and a bulk operation, cancelled before, and operations
+// on single messages are finished
+type Exit struct {
+}
+
 type FocusView struct {
 	ViewName string
 }
@@ -16,11 +34,13 @@ type FocusView struct {
 type FocusNextView struct {
 }
 
-type RequeueMessages struct {
+type ReleaseMessages struct {
 }
 
 type RequeueMessage struct {
 	MessageIdx int
+	// Confirmed is set, when user has agreed to replay a message, which has reached replay limit
+	Confirmed bool
 }
 
 type ToggleShowHeaders struct {
@@ -84,3 +104,176 @@ type SqlViewScrollLeft struct {
 
 type SqlViewScrollRight struct {
 }
+
+// BrokerStatusChanged is reported by a broker connection. Generation tells, which connection reported it,
+// so events of a connection, closed on profile switch, could be ignored
+type BrokerStatusChanged struct {
+	Status     ConnectionStatus
+	Error      error
+	Generation uint64
+}
+
+type ShowProfilesPopup struct {
+}
+
+type ProfilesListNextOption struct {
+}
+
+type ProfilesListPrevOption struct {
+}
+
+type SwitchProfile struct {
+}
+
+type ShowMoveToPopup struct {
+}
+
+type MoveToListNextOption struct {
+}
+
+type MoveToListPrevOption struct {
+}
+
+type MoveMessage struct {
+	MessageIdx int
+}
+
+type EditMessage struct {
+	MessageIdx int
+}
+
+type MessageEdited struct {
+	MessageIdx int
+	Message    MessageStruct
+}
+
+type ToggleMessageSelection struct {
+	MessageIdx int
+}
+
+type SelectRange struct {
+	// Direction is either 1 or -1
+	Direction int
+}
+
+type ToggleSelectAllVisible struct {
+}
+
+type ShowFilterPopup struct {
+}
+
+// FilterTextChanged is dispatched by the filter popup on input, so the selection is updated with the filter
+type FilterTextChanged struct {
+	Text string
+}
+
+type ClearFilter struct {
+}
+
+type StartBulkOperation struct {
+	Kind        BulkOperationKind
+	Destination Destination
+	// Confirmed is set, when user has agreed to replay messages, which have reached replay limit
+	Confirmed bool
+}
+
+// MessageProcessed is enqueued, once a single message is requeued, dropped or moved in background
+type MessageProcessed struct {
+	Kind      BulkOperationKind
+	MessageId uint64
+	Error     error
+}
+
+type BulkMessageProcessed struct {
+	Result BulkResult
+}
+
+type BulkOperationFinished struct {
+}
+
+// PauseBulkOperation toggles pause of a running bulk operation
+type PauseBulkOperation struct {
+}
+
+type CancelBulkOperation struct {
+}
+
+type DiscoverQueues struct {
+}
+
+// QueuesDiscovered is enqueued, once management API listed queues of a profile, which was active at the time
+type QueuesDiscovered struct {
+	ProfileIdx int
+	Options    []SelectableOption
+	Error      error
+}
+
+type ShowQueuesPopup struct {
+}
+
+type QueuesListNextOption struct {
+}
+
+type QueuesListPrevOption struct {
+}
+
+type UseSelectedQueue struct {
+}
+
+type QueueStatsUpdated struct {
+	Dlq        QueueStatsStruct
+	Queue      QueueStatsStruct
+	Generation uint64
+}
+
+// ShowConfirmPopup asks user to confirm an action; Confirmed action is dispatched, if user agrees
+type ShowConfirmPopup struct {
+	Text      string
+	Confirmed any
+}
+
+// RestoreMessages republishes messages, which were taken by an interrupted session, to the DLQ
+type RestoreMessages struct {
+}
+
+type ToggleShowGroups struct {
+}
+
+type NextGroup struct {
+}
+
+type PrevGroup struct {
+}
+
+// NextGroupKey switches grouping to the next configured key
+type NextGroupKey struct {
+}
+
+// FilterBySelectedGroup limits the list to messages of the selected group
+type FilterBySelectedGroup struct {
+}
+
+// NextBodyViewer cycles viewers, message body is shown with
+type NextBodyViewer struct {
+}
+
+type ShowExportPopup struct {
+}
+
+type ExportListNextOption struct {
+}
+
+type ExportListPrevOption struct {
+}
+
+// ExportMessages writes messages of the scope, selected in the export popup, to a JSONL file or a directory
+type ExportMessages struct {
+	Directory bool
+}
+
+type ShowImportPopup struct {
+}
+
+// ImportMessages appends messages, read from the typed in path, to the list
+type ImportMessages struct {
+}
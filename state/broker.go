@@ -0,0 +1,52 @@
+package state
+
+import (
+	"context"
+	"time"
+)
+
+// Broker is a place, dead-lettered messages are taken from and replayed to, e.g. a RabbitMQ DLQ or a Kafka DLT
+type Broker interface {
+	// LoadMessages takes the next page of dead-lettered messages, passing them to onLoaded in batches
+	LoadMessages(ctx context.Context, onLoaded func([]MessageStruct)) error
+	// CountMessages returns number of dead-lettered messages, which are ready to be loaded
+	CountMessages() (int, error)
+	// ReleaseMessages gives loaded messages back, so they are loaded again next time
+	ReleaseMessages(messages []MessageStruct) error
+	// AckMessage removes a loaded message for good
+	AckMessage(message MessageStruct) error
+	// RequeueMessage publishes a message to its destination and removes it
+	RequeueMessage(message MessageStruct) error
+	// MoveMessage publishes a message as is to the given destination and removes it
+	MoveMessage(message MessageStruct, destination Destination) error
+	// RestoreMessages publishes messages back to the dead-letter queue as they are
+	RestoreMessages(messages []MessageStruct) error
+	// MonitorQueues periodically reports stats of the dead-letter queue and the target queue, until broker is closed
+	MonitorQueues(listener StatsListener)
+	// IsBrowsing tells, whether loaded messages are still owned by the broker
+	IsBrowsing() bool
+	// ResolveDestination finds where a message should be replayed to, according to the configured replay target
+	ResolveDestination(message MessageStruct) Destination
+	ReachesReplayLimit(message MessageStruct) bool
+	WarnsOnReplayLimit() bool
+	// DryRunOperations returns operations, which were skipped because of a dry run
+	DryRunOperations() []DryRunOperation
+	Close()
+}
+
+// StatusListener is notified about every change of a broker connection status
+type StatusListener func(status ConnectionStatus, err error)
+
+// StatsListener receives fresh stats of the dead-letter queue and the target queue
+type StatsListener func(dlq, queue QueueStatsStruct)
+
+// DryRunOperation is a mutating operation, which would have been sent to the broker, if it wasn't a dry run
+type DryRunOperation struct {
+	At          time.Time `json:"at"`
+	Operation   string    `json:"operation"`
+	Dlq         string    `json:"dlq"`
+	Exchange    string    `json:"exchange,omitempty"`
+	RoutingKey  string    `json:"routingKey,omitempty"`
+	MessageId   string    `json:"messageId,omitempty"`
+	DeliveryTag uint64    `json:"deliveryTag,omitempty"`
+}
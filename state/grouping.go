@@ -0,0 +1,115 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NoGroupValue is a group of messages, which have nothing under a grouping key
+const NoGroupValue = "(none)"
+
+// MessageGroup is a bucket of messages, which have the same value under a grouping key
+type MessageGroup struct {
+	Value string
+	Count int
+}
+
+// GroupValue returns a value of a message under a grouping key. Key is either a path into headers, e.g.
+// "x-death[0].reason" or "x-first-death-queue", or a JSONPath into a JSON body, starting with "$", e.g. "$.error.code"
+func GroupValue(message MessageStruct, key string) string {
+	var root any = message.Headers
+	path := key
+	if strings.HasPrefix(key, "$") {
+		if err := json.Unmarshal([]byte(message.Body), &root); err != nil {
+			return NoGroupValue
+		}
+		path = strings.TrimPrefix(strings.TrimPrefix(key, "$"), ".")
+	}
+
+	value, ok := lookup(root, path)
+	if !ok || value == nil {
+		return NoGroupValue
+	}
+	if reflect.ValueOf(value).Kind() == reflect.Map || reflect.ValueOf(value).Kind() == reflect.Slice {
+		if encoded, err := json.Marshal(value); err == nil {
+			return string(encoded)
+		}
+	}
+	return fmt.Sprint(value)
+}
+
+// lookup follows a path of field names and [index] segments, e.g. "x-death[0].reason".
+// Maps and slices are accessed via reflection, as AMQP headers use their own named types for them.
+func lookup(value any, path string) (any, bool) {
+	for path != "" {
+		current := reflect.ValueOf(value)
+		if strings.HasPrefix(path, "[") {
+			end := strings.Index(path, "]")
+			if end < 0 {
+				return nil, false
+			}
+			idx, err := strconv.Atoi(path[1:end])
+			if err != nil || current.Kind() != reflect.Slice || idx < 0 || idx >= current.Len() {
+				return nil, false
+			}
+			value = current.Index(idx).Interface()
+			path = strings.TrimPrefix(path[end+1:], ".")
+			continue
+		}
+
+		end := strings.IndexAny(path, ".[")
+		if end < 0 {
+			end = len(path)
+		}
+		if current.Kind() != reflect.Map || current.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		field := current.MapIndex(reflect.ValueOf(path[:end]).Convert(current.Type().Key()))
+		if !field.IsValid() {
+			return nil, false
+		}
+		value = field.Interface()
+		path = strings.TrimPrefix(path[end:], ".")
+	}
+	return value, true
+}
+
+// GroupKey returns a grouping key in use
+func (s *State) GroupKey() string {
+	if len(s.GroupKeys) == 0 {
+		return ""
+	}
+	return s.GroupKeys[s.GroupKeyIdx%len(s.GroupKeys)]
+}
+
+// MessageGroups buckets messages, which match the text filter, by a grouping key; the largest groups go first
+func (s *State) MessageGroups() []MessageGroup {
+	key := s.GroupKey()
+	if key == "" {
+		return []MessageGroup{}
+	}
+
+	textFilter := MessageFilter{Text: s.Filter.Text}
+	counts := make(map[string]int)
+	for _, message := range s.Messages {
+		if textFilter.Matches(message) {
+			counts[GroupValue(message, key)]++
+		}
+	}
+
+	groups := make([]MessageGroup, 0, len(counts))
+	for value, count := range counts {
+		groups = append(groups, MessageGroup{Value: value, Count: count})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return groups[i].Value < groups[j].Value
+	})
+	return groups
+}
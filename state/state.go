@@ -1,6 +1,8 @@
 package state
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"DeadRabbit/commons"
@@ -11,6 +13,83 @@ type NotificationStruct struct {
 	At    time.Time
 }
 
+type ConnectionStatus int
+
+const (
+	Connecting ConnectionStatus = iota
+	Connected
+	Reconnecting
+	Failed
+)
+
+func (s ConnectionStatus) String() string {
+	switch s {
+	case Connecting:
+		return "connecting"
+	case Connected:
+		return "connected"
+	case Reconnecting:
+		return "reconnecting"
+	case Failed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+type BrokerStatusStruct struct {
+	Status ConnectionStatus
+	Error  string
+	At     time.Time
+}
+
+// QueueStatsStruct is a snapshot of a queue, taken by a background monitor
+type QueueStatsStruct struct {
+	Name      string
+	Messages  int
+	Consumers int
+	// Rate is how fast number of messages changes, per second
+	Rate  float64
+	Error string
+	At    time.Time
+}
+
+type BulkOperationKind string
+
+const (
+	BulkRequeue BulkOperationKind = "requeue"
+	BulkDrop    BulkOperationKind = "drop"
+	BulkMove    BulkOperationKind = "move"
+)
+
+type BulkResult struct {
+	MessageId uint64
+	Error     error
+}
+
+type BulkOperationStruct struct {
+	Kind    BulkOperationKind
+	Total   int
+	Results []BulkResult
+	Paused  bool
+	// Done is set, when all messages are processed or operation is cancelled
+	Done bool
+}
+
+func (b BulkOperationStruct) IsFinished() bool {
+	return b.Done
+}
+
+func (b BulkOperationStruct) Failed() int {
+	failed := 0
+	for _, result := range b.Results {
+		if result.Error != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
 type FillQueryParamsPopupData struct {
 	Ctx              QueryContext
 	SelectedParamIdx int
@@ -29,18 +108,42 @@ type SqlResultsViewData struct {
 }
 
 type State struct {
-	InputMode            bool
-	Debug                bool
-	Messages             []MessageStruct
-	SelectedMessageIdx   int
-	Notification         *NotificationStruct
-	AppActions           []string
-	ShowHeaders          bool
-	FocusedViews         *commons.Stack[string]
-	SelectQueryPopup     SelectQueryPopupData
+	InputMode bool
+	Debug     bool
+	// DryRun is set, when nothing is sent to the broker and operations change only local state
+	DryRun          bool
+	Messages        []MessageStruct
+	LoadingMessages bool
+	// QueueDepth is how many messages are left in the DLQ, not counting loaded ones
+	QueueDepth int
+	Filter     MessageFilter
+	ShowGroups bool
+	// GroupKeys are keys, messages could be grouped by; GroupKeyIdx points to one in use
+	GroupKeys          []string
+	GroupKeyIdx        int
+	SelectedGroupIdx   int
+	BulkOperation      *BulkOperationStruct
+	SelectedMessageIdx int
+	Notification       *NotificationStruct
+	AppActions         []string
+	ShowHeaders        bool
+	// BodyViewer is a name of a viewer, message body is shown with; empty one means it's detected automatically
+	BodyViewer         string
+	FocusedViews       *commons.Stack[string]
+	SelectQueryPopup   SelectQueryPopupData
+	SelectProfilePopup SelectQueryPopupData
+	MoveToPopup        SelectQueryPopupData
+	ExportPopup        SelectQueryPopupData
+	// ImportPath is a JSONL file or a directory, typed in the import popup
+	ImportPath           string
+	SelectQueuePopup     SelectQueryPopupData
+	ActiveProfile        string
 	FillQueryParamsPopup FillQueryParamsPopupData
 	DatabaseOutputs      *DatabaseData
 	SqlResultsView       *SqlResultsViewData
+	BrokerStatus         BrokerStatusStruct
+	DlqStats             QueueStatsStruct
+	TargetQueueStats     QueueStatsStruct
 }
 
 type SelectQueryPopupData struct {
@@ -49,9 +152,62 @@ type SelectQueryPopupData struct {
 	SelectedIdx int
 }
 
+type MessageProperties struct {
+	ContentType     string
+	ContentEncoding string
+	DeliveryMode    uint8
+	Priority        uint8
+	CorrelationId   string
+	ReplyTo         string
+	Expiration      string
+	MessageId       string
+	Timestamp       time.Time
+	Type            string
+	UserId          string
+	AppId           string
+	// Key is a key of a Kafka message; RabbitMQ messages don't have it
+	Key string
+}
+
+// Destination is a place, where a message is published to
+type Destination struct {
+	Exchange   string
+	RoutingKey string
+}
+
+func (d Destination) String() string {
+	if d.Exchange == "" {
+		return d.RoutingKey
+	}
+	return d.Exchange + "/" + d.RoutingKey
+}
+
 type MessageStruct struct {
-	Body    string
-	Headers map[string]any
+	// Id identifies message in the list, it's unique within a session
+	Id         uint64
+	Body       string
+	Headers    map[string]any
+	Properties MessageProperties
+	// Destination is where message will be replayed to
+	Destination Destination
+	// Selected is set, when message is marked by user for a bulk operation
+	Selected bool
+	// Original is the message, as it was received, before user has edited it
+	Original *MessageStruct
+	// Error describes the last failed attempt to requeue or drop the message
+	Error string
+	// Compression is a content encoding, Body was decompressed from; empty, if Body is as it was received
+	Compression string
+	// CompressedBody is a body, as it was received; it's cleared, when message is edited, so Body is compressed again
+	CompressedBody string
+	// ReplayCount is how many times message has been replayed already
+	ReplayCount int
+	// DeliveryTag is set for messages, which are held unacknowledged in a browse mode
+	DeliveryTag uint64
+	// Imported is set for messages, read from a file; they aren't in the DLQ, so they are never given back to it
+	Imported bool
+	// Processing is set, while the message is requeued, dropped or moved in background
+	Processing bool
 }
 
 type SelectableOption struct {
@@ -80,3 +236,104 @@ type QueryResults interface {
 type Repository interface {
 	Query(sql string, params map[string]string) QueryResults
 }
+
+// MessageFilter limits messages, shown in the list, and ones, bulk operations are applied to
+type MessageFilter struct {
+	Text string
+	// Group limits messages to ones, which have the value under the grouping key
+	Group *GroupFilter
+}
+
+type GroupFilter struct {
+	Key   string
+	Value string
+}
+
+func (f MessageFilter) IsEmpty() bool {
+	return f.Text == "" && f.Group == nil
+}
+
+func (f MessageFilter) String() string {
+	parts := make([]string, 0, 2)
+	if f.Text != "" {
+		parts = append(parts, f.Text)
+	}
+	if f.Group != nil {
+		parts = append(parts, f.Group.Key+"="+f.Group.Value)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (f MessageFilter) Matches(message MessageStruct) bool {
+	if f.Group != nil && GroupValue(message, f.Group.Key) != f.Group.Value {
+		return false
+	}
+	if f.Text == "" {
+		return true
+	}
+	text := strings.ToLower(f.Text)
+	return strings.Contains(strings.ToLower(message.Body), text) ||
+		strings.Contains(strings.ToLower(fmt.Sprint(message.Headers)), text)
+}
+
+// VisibleMessagesIdx returns indexes of messages, which match the filter
+func (s *State) VisibleMessagesIdx() []int {
+	result := make([]int, 0, len(s.Messages))
+	for i, message := range s.Messages {
+		if s.Filter.Matches(message) {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+// MarkedMessages returns messages, marked by user, which match the filter; marked ones, which are hidden by
+// the filter, e.g. in other groups, are left out
+func (s *State) MarkedMessages() []MessageStruct {
+	result := make([]MessageStruct, 0)
+	for _, message := range s.Messages {
+		if message.Selected && s.Filter.Matches(message) {
+			result = append(result, message)
+		}
+	}
+	return result
+}
+
+// SelectedMessages returns marked messages, which match the filter, or a current one, if nothing is marked
+func (s *State) SelectedMessages() []MessageStruct {
+	result := s.MarkedMessages()
+	if len(result) == 0 && s.SelectedMessageIdx >= 0 && s.SelectedMessageIdx < len(s.Messages) &&
+		s.Filter.Matches(s.Messages[s.SelectedMessageIdx]) {
+		result = append(result, s.Messages[s.SelectedMessageIdx])
+	}
+	return result
+}
+
+// IsProcessingMessages tells, whether any single message operation is still waiting for the broker
+func (s *State) IsProcessingMessages() bool {
+	for _, message := range s.Messages {
+		if message.Processing {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *State) FindMessage(id uint64) int {
+	for i, message := range s.Messages {
+		if message.Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// ExportScope tells, which messages are exported
+type ExportScope int
+
+const (
+	ExportCurrent ExportScope = iota
+	// ExportFiltered exports messages, matching the filter, or all of them, if there is no filter
+	ExportFiltered
+	ExportMarked
+)
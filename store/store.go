@@ -17,6 +17,7 @@ type Store[STATE any] struct {
 	subscriptionsIdx int
 	reducers         map[int]Reducer[STATE]
 	reducersIdx      int
+	queued           chan Action
 }
 
 func NewStore[STATE any](initial STATE) *Store[STATE] {
@@ -26,6 +27,7 @@ func NewStore[STATE any](initial STATE) *Store[STATE] {
 		subscribers:      make(map[int]chan<- STATE),
 		reducers:         make(map[int]Reducer[STATE]),
 		reducersIdx:      0,
+		queued:           make(chan Action, 100),
 	})
 }
 
@@ -66,6 +68,16 @@ func (s *Store[STATE]) Dispatch(action Action) {
 	log.Printf("Action %T handling finished", action)
 }
 
+// Enqueue schedules an action to be dispatched later by the UI loop.
+// Unlike Dispatch, it's safe to call from background goroutines.
+func (s *Store[STATE]) Enqueue(action Action) {
+	s.queued <- action
+}
+
+func (s *Store[STATE]) Queued() <-chan Action {
+	return s.queued
+}
+
 func (s Store[STATE]) GetCurrent() STATE {
 	return s.aState
 }
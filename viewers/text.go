@@ -0,0 +1,181 @@
+package viewers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"DeadRabbit/state"
+)
+
+type Json struct{}
+
+func (Json) Name() string {
+	return "json"
+}
+
+// Detects requires an object or an array root, as bare numbers and strings are valid JSON too
+func (Json) Detects(message state.MessageStruct) bool {
+	if hasContentType(message, "json") {
+		return true
+	}
+	body := strings.TrimSpace(message.Body)
+	return (strings.HasPrefix(body, "{") || strings.HasPrefix(body, "[")) && json.Valid([]byte(body))
+}
+
+func (Json) View(message state.MessageStruct) (string, error) {
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, []byte(message.Body), "", "    "); err != nil {
+		return "", err
+	}
+	return pretty.String(), nil
+}
+
+type Xml struct{}
+
+func (Xml) Name() string {
+	return "xml"
+}
+
+func (Xml) Detects(message state.MessageStruct) bool {
+	return hasContentType(message, "xml") || strings.HasPrefix(strings.TrimSpace(message.Body), "<")
+}
+
+// View re-indents XML token by token, keeping comments and processing instructions
+func (Xml) View(message state.MessageStruct) (string, error) {
+	decoder := xml.NewDecoder(strings.NewReader(message.Body))
+	decoder.Strict = false
+	var pretty bytes.Buffer
+	encoder := xml.NewEncoder(&pretty)
+	encoder.Indent("", "    ")
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if data, ok := token.(xml.CharData); ok {
+			// Whitespace between elements is replaced by indentation
+			if len(bytes.TrimSpace(data)) == 0 {
+				continue
+			}
+		}
+		if err := encoder.EncodeToken(xml.CopyToken(token)); err != nil {
+			return "", err
+		}
+	}
+	if err := encoder.Flush(); err != nil {
+		return "", err
+	}
+	return pretty.String(), nil
+}
+
+type Form struct{}
+
+func (Form) Name() string {
+	return "form"
+}
+
+func (Form) Detects(message state.MessageStruct) bool {
+	return hasContentType(message, "x-www-form-urlencoded")
+}
+
+func (Form) View(message state.MessageStruct) (string, error) {
+	values, err := url.ParseQuery(message.Body)
+	if err != nil {
+		return "", err
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	lines := make([]string, 0, len(values))
+	for _, key := range keys {
+		for _, value := range values[key] {
+			lines = append(lines, fmt.Sprintf("%s = %s", key, value))
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+type Base64 struct{}
+
+func (Base64) Name() string {
+	return "base64"
+}
+
+func (Base64) Detects(message state.MessageStruct) bool {
+	return strings.EqualFold(message.Properties.ContentEncoding, "base64")
+}
+
+// View decodes a body and shows it as a text, if it's a text, or as a hex dump otherwise
+func (Base64) View(message state.MessageStruct) (string, error) {
+	body := strings.TrimSpace(message.Body)
+	decoded, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		var urlErr error
+		if decoded, urlErr = base64.URLEncoding.DecodeString(body); urlErr != nil {
+			return "", err
+		}
+	}
+	if isText(string(decoded)) {
+		return string(decoded), nil
+	}
+	return hex.Dump(decoded), nil
+}
+
+// Raw shows a body as is
+type Raw struct{}
+
+func (Raw) Name() string {
+	return "raw"
+}
+
+func (Raw) Detects(message state.MessageStruct) bool {
+	return isText(message.Body)
+}
+
+func (Raw) View(message state.MessageStruct) (string, error) {
+	return message.Body, nil
+}
+
+type Hex struct{}
+
+func (Hex) Name() string {
+	return "hex"
+}
+
+func (Hex) Detects(state.MessageStruct) bool {
+	return true
+}
+
+func (Hex) View(message state.MessageStruct) (string, error) {
+	return strings.TrimSuffix(hex.Dump([]byte(message.Body)), "\n"), nil
+}
+
+// isText tells, whether a body is a valid UTF-8 without control characters, except for whitespace ones
+func isText(body string) bool {
+	if !utf8.ValidString(body) {
+		return false
+	}
+	for _, r := range body {
+		if r < 0x20 && r != '\n' && r != '\r' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
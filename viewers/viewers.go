@@ -0,0 +1,124 @@
+package viewers
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"DeadRabbit/state"
+)
+
+// Viewer renders a message body into a human-readable text
+type Viewer interface {
+	Name() string
+	// Detects tells, whether viewer suits the message, judging by its content type or the body itself
+	Detects(message state.MessageStruct) bool
+	View(message state.MessageStruct) (string, error)
+}
+
+// Codec is a viewer of a binary format, which could also encode an edited text back into a body
+type Codec interface {
+	Viewer
+	Encode(message state.MessageStruct, text string) (string, error)
+}
+
+var (
+	mu sync.RWMutex
+	// registered are ordered by priority of detection; fallback viewers are always the last ones
+	registered []Viewer
+	fallbacks  = []Viewer{Raw{}, Hex{}}
+)
+
+func init() {
+	Register(Json{}, Xml{}, Form{}, Base64{})
+}
+
+// Register adds viewers, which are detected before already registered ones
+func Register(viewers ...Viewer) {
+	mu.Lock()
+	defer mu.Unlock()
+	registered = append(append([]Viewer{}, viewers...), registered...)
+}
+
+func all() []Viewer {
+	mu.RLock()
+	defer mu.RUnlock()
+	return append(append([]Viewer{}, registered...), fallbacks...)
+}
+
+// Names returns names of all viewers in order they are cycled through
+func Names() []string {
+	viewers := all()
+	names := make([]string, 0, len(viewers))
+	for _, v := range viewers {
+		names = append(names, v.Name())
+	}
+	return names
+}
+
+// Next returns the viewer name, following the given one; empty name stands for automatic detection
+func Next(name string) string {
+	names := append([]string{""}, Names()...)
+	for i, n := range names {
+		if n == name {
+			return names[(i+1)%len(names)]
+		}
+	}
+	return ""
+}
+
+// Detect returns the first viewer, which suits the message and manages to show it.
+// Viewer, which fails to parse a body, e.g. a text starting with "<", gives way to the next one
+func Detect(message state.MessageStruct) Viewer {
+	for _, v := range all() {
+		if !v.Detects(message) {
+			continue
+		}
+		if _, err := v.View(message); err == nil {
+			return v
+		}
+	}
+	return Fallback(message)
+}
+
+// View renders a body with a viewer by name, or with a detected one, if name is empty.
+// Returns a name of the used viewer along with the text.
+func View(message state.MessageStruct, name string) (string, string, error) {
+	if name == "" {
+		v := Detect(message)
+		text, err := v.View(message)
+		return v.Name(), text, err
+	}
+
+	for _, v := range all() {
+		if v.Name() == name {
+			text, err := v.View(message)
+			return name, text, err
+		}
+	}
+	return name, "", fmt.Errorf("unknown viewer %s", name)
+}
+
+// DetectCodec returns a codec, if message body is in a binary format, which could be decoded and encoded back
+func DetectCodec(message state.MessageStruct) (Codec, bool) {
+	codec, ok := Detect(message).(Codec)
+	return codec, ok
+}
+
+// Fallback returns a viewer, which could show any body: raw one for texts and hex dump for binaries
+func Fallback(message state.MessageStruct) Viewer {
+	if (Raw{}).Detects(message) {
+		return Raw{}
+	}
+	return Hex{}
+}
+
+func hasContentType(message state.MessageStruct, fragments ...string) bool {
+	contentType := strings.ToLower(message.Properties.ContentType)
+	for _, fragment := range fragments {
+		if strings.Contains(contentType, fragment) {
+			return true
+		}
+	}
+	return false
+}